@@ -31,10 +31,17 @@ type BaeSayHandler interface {
 }
 
 // Baevent is a Bae Event. Specifically, it encapsulates a user sending a
-// message in a discord channel containing the bae.
+// message in a discord channel containing the bae. GuildID is empty for direct
+// messages.
 type Baevent struct {
 	Speaker *BaestFriend
-	Message string
+	// SpeakerRoles holds the names of the speaker's roles in the guild, if the
+	// message was sent in one.
+	SpeakerRoles []string
+	Message      string
+	ChannelID    string
+	GuildID      string
+	MessageID    string
 }
 
 // Baesponse contains the bae's response to a Baevent. Beyond the message to be
@@ -45,28 +52,68 @@ type Baesponse struct {
 	Message         string
 	MentionUser     bool
 	HandlerMetadata interface{}
+	// Files are uploaded to the channel alongside the message. They are not
+	// kept in the bae's history.
+	Files []*BaeFile
+	// Supersedes is the ID of an earlier BaeHistoryEntry this response
+	// replaces, e.g., a roll that was redone. The earlier entry is kept, but
+	// marked as superseded.
+	Supersedes string
+	// Pinned responses, like the start of a game session, don't count toward
+	// their channel's history limit and are never evicted to make room, so
+	// later responses can still find them. They still expire with age.
+	Pinned bool
+}
+
+// BaeFile is a file the bae uploads along with a Baesponse.
+type BaeFile struct {
+	Name        string
+	ContentType string
+	Data        []byte
 }
 
 // BaestFriend defines a user entity in discord. The ID can be used to <@ID>
 // mention a user in a Baesponse and the username is the human-readable
 // username. This is essentially a subset of the User fields from discordgo.
 type BaestFriend struct {
-	ID       string
-	Username string
+	ID       string `json:"id"`
+	Username string `json:"username"`
 }
 
 // BaeHistoKey contains optional constraints when searching the bae's history.
+// Since and Until bound the time an entry was said, inclusive of Since and
+// exclusive of Until.
 type BaeHistoKey struct {
 	BaestFriendID string
 	HandlerName   string
+	ChannelID     string
+	GuildID       string
+	Since         time.Time
+	Until         time.Time
+	// Superseded entries are skipped unless IncludeSuperseded is set.
+	IncludeSuperseded bool
+	// Filter, if set, is applied to entries that satisfy every other
+	// constraint. It lets handlers search on their own HandlerMetadata.
+	Filter func(*BaeHistoryEntry) bool
 }
 
 // BaeHistoryEntry contains a single bae response along with metadata about what handler
+// produced it, when, and for whom. Entries are persisted as JSON, so any
+// HandlerMetadata should be registered with RegisterMetadata.
 type BaeHistoryEntry struct {
-	HandlerName string
-	Response    *Baesponse
-	TimeSaid    time.Time
-	RepliedTo   *BaestFriend
+	// ID uniquely identifies the entry.
+	ID          string       `json:"id"`
+	HandlerName string       `json:"handlerName"`
+	Response    *Baesponse   `json:"response"`
+	TimeSaid    time.Time    `json:"timeSaid"`
+	RepliedTo   *BaestFriend `json:"repliedTo"`
+	ChannelID   string       `json:"channelId,omitempty"`
+	GuildID     string       `json:"guildId,omitempty"`
+	// MessageID is the ID of the message the bae replied to.
+	MessageID string `json:"messageId,omitempty"`
+	// SupersededBy is the ID of the entry that replaced this one, if any. It is
+	// not stored, but restored from the replacing entry's Response.Supersedes.
+	SupersededBy string `json:"-"`
 }
 
 // Mention returns a modified message string that will trigger a mention, e.g.,
@@ -79,7 +126,19 @@ func (he *BaeHistoryEntry) Matches(k *BaeHistoKey) bool {
 	switch {
 	case k.HandlerName != "" && k.HandlerName != he.HandlerName:
 		return false
-	case k.BaestFriendID != "" && k.BaestFriendID != he.RepliedTo.ID:
+	case k.BaestFriendID != "" && (he.RepliedTo == nil || k.BaestFriendID != he.RepliedTo.ID):
+		return false
+	case k.ChannelID != "" && k.ChannelID != he.ChannelID:
+		return false
+	case k.GuildID != "" && k.GuildID != he.GuildID:
+		return false
+	case !k.Since.IsZero() && he.TimeSaid.Before(k.Since):
+		return false
+	case !k.Until.IsZero() && !he.TimeSaid.Before(k.Until):
+		return false
+	case !k.IncludeSuperseded && he.SupersededBy != "":
+		return false
+	case k.Filter != nil && !k.Filter(he):
 		return false
 	default:
 		return true
@@ -0,0 +1,97 @@
+package baepi
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+var (
+	metadataMu    sync.RWMutex
+	metadataTypes = make(map[string]reflect.Type)
+	metadataNames = make(map[reflect.Type]string)
+)
+
+// RegisterMetadata records the concrete type of a handler's HandlerMetadata
+// under a stable name, so that history entries written to disk can be restored
+// with typed metadata instead of a generic map. Handlers should register their
+// metadata types from an init function. Registering a name twice panics.
+func RegisterMetadata(name string, v interface{}) {
+	metadataMu.Lock()
+	defer metadataMu.Unlock()
+	t := reflect.TypeOf(v)
+	if _, ok := metadataTypes[name]; ok {
+		panic(fmt.Sprintf("baepi: metadata %q registered twice", name))
+	}
+	metadataTypes[name] = t
+	metadataNames[t] = name
+}
+
+// baesponseJSON is the on-disk form of a Baesponse. The metadata type name is
+// stored alongside the metadata so it can be decoded into the right type.
+type baesponseJSON struct {
+	Message      string          `json:"message"`
+	MentionUser  bool            `json:"mentionUser,omitempty"`
+	MetadataType string          `json:"metadataType,omitempty"`
+	Metadata     json.RawMessage `json:"metadata,omitempty"`
+	Supersedes   string          `json:"supersedes,omitempty"`
+}
+
+// MarshalJSON encodes the Baesponse along with the registered name of its
+// HandlerMetadata type.
+func (r *Baesponse) MarshalJSON() ([]byte, error) {
+	out := baesponseJSON{
+		Message:     r.Message,
+		MentionUser: r.MentionUser,
+		Supersedes:  r.Supersedes,
+	}
+	if r.HandlerMetadata != nil {
+		metadataMu.RLock()
+		out.MetadataType = metadataNames[reflect.TypeOf(r.HandlerMetadata)]
+		metadataMu.RUnlock()
+		md, err := json.Marshal(r.HandlerMetadata)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal handler metadata: %v", err)
+		}
+		out.Metadata = md
+	}
+	return json.Marshal(out)
+}
+
+// UnmarshalJSON decodes a Baesponse, restoring HandlerMetadata as its
+// registered type. Metadata of an unknown type is kept as a json.RawMessage.
+func (r *Baesponse) UnmarshalJSON(b []byte) error {
+	var in baesponseJSON
+	if err := json.Unmarshal(b, &in); err != nil {
+		return err
+	}
+	r.Message = in.Message
+	r.MentionUser = in.MentionUser
+	r.Supersedes = in.Supersedes
+	r.HandlerMetadata = nil
+	if len(in.Metadata) == 0 {
+		return nil
+	}
+	metadataMu.RLock()
+	t, ok := metadataTypes[in.MetadataType]
+	metadataMu.RUnlock()
+	if !ok {
+		r.HandlerMetadata = in.Metadata
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		v := reflect.New(t.Elem())
+		if err := json.Unmarshal(in.Metadata, v.Interface()); err != nil {
+			return fmt.Errorf("failed to unmarshal %s metadata: %v", in.MetadataType, err)
+		}
+		r.HandlerMetadata = v.Interface()
+		return nil
+	}
+	v := reflect.New(t)
+	if err := json.Unmarshal(in.Metadata, v.Interface()); err != nil {
+		return fmt.Errorf("failed to unmarshal %s metadata: %v", in.MetadataType, err)
+	}
+	r.HandlerMetadata = v.Elem().Interface()
+	return nil
+}
@@ -4,15 +4,20 @@ package main
 import (
 	"flag"
 	"fmt"
-	"strconv"
 	"strings"
+	"time"
 
 	"dicebae"
 )
 
 var (
-	apiKey       = flag.String("key", "", "The Bot API key, it's a secret to everyone.")
-	playerIDList = flag.String("players", "", "A comma-separated list of DNDBeyond player IDs. This is the number in a character sheet URL.")
+	apiKey     = flag.String("key", "", "The Bot API key, it's a secret to everyone.")
+	playerList = flag.String("players", "", "A comma-separated list of characters. Each is a DNDBeyond player ID (the number in a character sheet URL), file:path/to/sheet.yaml, or foundry:path/to/actor.json.")
+	gmRole     = flag.String("gm_role", "GM", "The Discord role allowed to add and remove characters with !party.")
+	aliasList  = flag.String("aliases", "", "A comma-separated list of character nicknames, like kk=Kira Vale.")
+	dataDir    = flag.String("data_dir", "", "Where the bae keeps her history and character sheets between restarts. If unset, everything is forgotten on exit.")
+	cacheTTL   = flag.Duration("cache_ttl", 10*time.Minute, "How long to use a character sheet before refetching it from DNDBeyond.")
+	announceCh = flag.String("announce_channel", "", "The ID of a Discord channel where the bae celebrates level-ups and other character sheet changes. If unset, she keeps it to herself.")
 
 	maxShownHistory = 10
 )
@@ -23,22 +28,35 @@ func main() {
 		fmt.Println("You need to provide --key=<the dicebae API key>")
 		return
 	}
-	var playerIDs []int
-	if ids := *playerIDList; ids != "" {
-		for _, tk := range strings.Split(ids, ",") {
-			v, err := strconv.ParseInt(tk, 10, 64)
-			if err != nil {
-				fmt.Printf("Invalid player IDs %q, parse error: %v\n", *playerIDList, err)
+	var characters []string
+	if specs := *playerList; specs != "" {
+		characters = strings.Split(specs, ",")
+	}
+	aliases := make(map[string]string)
+	if list := *aliasList; list != "" {
+		for _, a := range strings.Split(list, ",") {
+			kv := strings.SplitN(a, "=", 2)
+			if len(kv) != 2 {
+				fmt.Printf("Aliases look like nickname=Character Name, not %q\n", a)
 				return
 			}
-			playerIDs = append(playerIDs, int(v))
+			aliases[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
 		}
 	}
-	db, err := dicebae.NewBae(&dicebae.Baergs{APIKey: *apiKey, PlayerIDs: playerIDs})
+	db, err := dicebae.NewBae(&dicebae.Baergs{
+		APIKey:          *apiKey,
+		Characters:      characters,
+		Aliases:         aliases,
+		GMRole:          *gmRole,
+		DataDir:         *dataDir,
+		CacheTTL:        *cacheTTL,
+		AnnounceChannel: *announceCh,
+	})
 	if err != nil {
-		fmt.Errorf("Failed to create the bae: %v", err)
+		fmt.Printf("Failed to create the bae: %v\n", err)
+		return
 	}
 	if err := db.LetsRoll(); err != nil {
-		fmt.Errorf("This bae won't roll: %v", err)
+		fmt.Printf("This bae won't roll: %v\n", err)
 	}
 }
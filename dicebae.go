@@ -9,7 +9,9 @@ import (
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
+	"time"
 
 	"dicebae/baepi"
 
@@ -18,9 +20,23 @@ import (
 
 // Baergs contains arguments for the creation of the bae.
 type Baergs struct {
-	APIKey    string // Required.
-	PlayerIDs []int
-	LogDir    string
+	APIKey string // Required.
+	// Characters lists where to load each player character from, e.g., a
+	// D&D Beyond character ID or a local sheet.
+	Characters []string
+	// GMRole is the Discord role allowed to manage the party.
+	GMRole string
+	// Aliases maps nicknames to the names of the characters they stand for.
+	Aliases map[string]string
+	LogDir  string
+	// DataDir is where the bae keeps state that should survive a restart, like
+	// her history and cached character sheets. If empty, nothing is persisted.
+	DataDir string
+	// CacheTTL is how long a character sheet is used before it's refetched.
+	CacheTTL time.Duration
+	// AnnounceChannel is the ID of the Discord channel where the bae celebrates
+	// level-ups and other character sheet changes. If empty, she doesn't.
+	AnnounceChannel string
 }
 
 // diceBae implements the DiceBae interface defined in the baepi.
@@ -28,7 +44,10 @@ type diceBae struct {
 	session *discordgo.Session
 	logFile *os.File
 	logger  *log.Logger
-	history []*baepi.BaeHistoryEntry
+
+	historyMu    sync.Mutex
+	history      *historyIndex
+	historyStore historyStore
 }
 
 // NewBae returns a hot, fresh bae with validated and initialized handlers.
@@ -40,11 +59,13 @@ func NewBae(args *Baergs) (baepi.DiceBae, error) {
 
 	db := &diceBae{
 		session: dg,
-		history: make([]*baepi.BaeHistoryEntry, 0, 1024),
 	}
 	if err := db.initLogger(args.LogDir); err != nil {
 		return nil, fmt.Errorf("bae failed to init logger: %v", err)
 	}
+	if err := db.initHistory(args.DataDir); err != nil {
+		return nil, fmt.Errorf("bae failed to init history: %v", err)
+	}
 	if err := db.initHandlers(args); err != nil {
 		return nil, fmt.Errorf("bae failed to init handlers: %v", err)
 	}
@@ -59,6 +80,7 @@ func (db *diceBae) LetsRoll() error {
 	}
 	defer db.session.Close()
 	defer db.logFile.Close()
+	defer db.historyStore.close()
 
 	db.LogInfo("I have no dice, but I must roll. Press CTRL-C to exit.")
 	sc := make(chan os.Signal, 1)
@@ -3,22 +3,68 @@
 package dicebae
 
 import (
+	"bytes"
+	"fmt"
+	"path"
 	"time"
 
 	"dicebae/baepi"
 	"dicebae/player"
 	"dicebae/roll"
+	"dicebae/session"
 
 	"github.com/bwmarrin/discordgo"
 )
 
 func (db *diceBae) initHandlers(args *Baergs) error {
-	db.addBaeSaysHandler("roll", roll.NewRollHandler())
+	rh := roll.NewRollHandler()
+	db.addBaeSaysHandler("roll", rh)
+	// Rerolls are rolls too, so they share a history name with regular rolls.
+	db.addBaeSaysHandler("roll", roll.NewRerollHandler(rh))
 	db.addBaeSaysHandler("history", roll.NewHistoryHandler(10, "history"))
 	db.addBaeSaysHandler("latest", roll.NewHistoryHandler(1, "latest"))
-	if len(args.PlayerIDs) > 0 {
-		db.addBaeSaysHandler("player", player.NewPlayerHandler(args.PlayerIDs))
+	db.addBaeSaysHandler("export", roll.NewExportHandler())
+	db.addBaeSaysHandler("session", session.NewSessionHandler("session"))
+	// Even without any characters to start with, GMs can !party add some.
+	pargs := &player.PlayerArgs{
+		Characters: args.Characters,
+		Aliases:    args.Aliases,
+		GMRole:     args.GMRole,
+		CacheTTL:   args.CacheTTL,
 	}
+	if ch := args.AnnounceChannel; ch != "" {
+		pargs.Announce = func(msg string) {
+			if err := db.send(ch, msg, nil); err != nil {
+				db.LogError("Failed to announce %q: %v", msg, err)
+			}
+		}
+	}
+	if args.DataDir != "" {
+		pargs.CacheDir = path.Join(args.DataDir, "characters")
+		pargs.StateDir = args.DataDir
+	}
+	ph, err := player.NewPlayerHandler(pargs)
+	if err != nil {
+		return fmt.Errorf("failed to init player handler: %v", err)
+	}
+	rh.ResolveVariablesWith(ph)
+	db.addBaeSaysHandler("player", ph)
+	db.addBaeSaysHandler("player", ph.IAmHandler())
+	db.addBaeSaysHandler("player", ph.PartyHandler())
+	db.addBaeSaysHandler("roll", ph.CheckHandler())
+	db.addBaeSaysHandler("roll", ph.SaveHandler())
+	db.addBaeSaysHandler("roll", ph.AttackHandler())
+	db.addBaeSaysHandler("player", ph.SlotsHandler())
+	db.addBaeSaysHandler("roll", ph.CastHandler())
+	db.addBaeSaysHandler("player", ph.DamageHandler())
+	db.addBaeSaysHandler("player", ph.HealHandler())
+	db.addBaeSaysHandler("player", ph.TempHPHandler())
+	db.addBaeSaysHandler("roll", ph.DeathSaveHandler())
+	db.addBaeSaysHandler("player", ph.RestHandler())
+	db.addBaeSaysHandler("player", ph.UseHandler())
+	db.addBaeSaysHandler("player", ph.ConditionHandler())
+	db.addBaeSaysHandler("player", ph.InventoryHandler())
+	db.addBaeSaysHandler("player", ph.GoldHandler())
 	return nil
 }
 
@@ -33,8 +79,18 @@ func (db *diceBae) addBaeSaysHandler(name string, bh baepi.BaeSayHandler) {
 			Username: m.Author.Username,
 		}
 		be := &baepi.Baevent{
-			Speaker: bf,
-			Message: m.Content,
+			Speaker:   bf,
+			Message:   m.Content,
+			ChannelID: m.ChannelID,
+			GuildID:   m.GuildID,
+			MessageID: m.ID,
+		}
+		if m.Member != nil {
+			for _, id := range m.Member.Roles {
+				if r, err := s.State.Role(m.GuildID, id); err == nil && r != nil {
+					be.SpeakerRoles = append(be.SpeakerRoles, r.Name)
+				}
+			}
 		}
 		if !bh.ShouldSay(db, be) {
 			// Nothing to say here.
@@ -43,19 +99,45 @@ func (db *diceBae) addBaeSaysHandler(name string, bh baepi.BaeSayHandler) {
 		resp, err := bh.SayWithBae(db, be)
 		if err != nil {
 			db.LogError("bae can't say! no way: %v", err)
+			return
 		}
 		msg := resp.Message
 		if resp.MentionUser {
 			msg = bf.Mention(resp.Message)
 		}
-		s.ChannelMessageSend(m.ChannelID, msg)
+		if err := db.send(m.ChannelID, msg, resp.Files); err != nil {
+			db.LogError("bae couldn't get a word in: %v", err)
+		}
 		he := &baepi.BaeHistoryEntry{
+			// Each handler replies at most once per message.
+			ID:          m.ID + "/" + name,
 			HandlerName: name,
 			Response:    resp,
 			TimeSaid:    time.Now(),
 			RepliedTo:   bf,
+			ChannelID:   m.ChannelID,
+			GuildID:     m.GuildID,
+			MessageID:   m.ID,
 		}
 		db.appendToHistory(he)
 		db.LogInfo("Sent response: %#v", resp)
 	})
 }
+
+// send posts a message to the channel, uploading any files along with it.
+func (db *diceBae) send(channelID, msg string, files []*baepi.BaeFile) error {
+	if len(files) == 0 {
+		_, err := db.session.ChannelMessageSend(channelID, msg)
+		return err
+	}
+	ms := &discordgo.MessageSend{Content: msg}
+	for _, f := range files {
+		ms.Files = append(ms.Files, &discordgo.File{
+			Name:        f.Name,
+			ContentType: f.ContentType,
+			Reader:      bytes.NewReader(f.Data),
+		})
+	}
+	_, err := db.session.ChannelMessageSendComplex(channelID, ms)
+	return err
+}
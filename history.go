@@ -3,37 +3,250 @@
 package dicebae
 
 import (
+	"sort"
+	"time"
+
 	"dicebae/baepi"
 )
 
 var (
-	maxHistoryEntries = 1000
+	// maxChannelHistory is how many entries each channel keeps, so a busy
+	// channel can't push a quiet one's history out.
+	maxChannelHistory = 1000
+	maxHistoryAge     = 90 * 24 * time.Hour
 )
 
-// FetchHistory returns up to n BaeHistoryEntries matching the constraints in
-// the given BaeHistoKey, from most recent to oldest. All fields in the key are
-// considered optional.
-func (db *diceBae) FetchHistory(k *baepi.BaeHistoKey, n int) []*baepi.BaeHistoryEntry {
-	if n > maxHistoryEntries {
-		n = maxHistoryEntries
+// historyIndex holds the retained history entries with per-user, per-channel
+// and per-ID indices. Each channel keeps at most capacity unpinned entries,
+// evicting its oldest unpinned one when it goes over. Entries are addressed by
+// an ever-increasing
+// sequence number, so index lists stay sorted from oldest to newest.
+type historyIndex struct {
+	capacity  int
+	next      uint64
+	entries   map[uint64]*baepi.BaeHistoryEntry
+	byID      map[string]uint64
+	byUser    map[string][]uint64
+	byChannel map[string][]uint64
+	// pinned counts each channel's pinned entries.
+	pinned map[string]int
+}
+
+func newHistoryIndex(capacity int) *historyIndex {
+	return &historyIndex{
+		capacity:  capacity,
+		entries:   make(map[uint64]*baepi.BaeHistoryEntry),
+		byID:      make(map[string]uint64),
+		byUser:    make(map[string][]uint64),
+		byChannel: make(map[string][]uint64),
+		pinned:    make(map[string]int),
 	}
-	// We could be more clever about this and actually index the history, but a
-	// linear scan should be fast enough given the limit on history size.
-	var ret []*baepi.BaeHistoryEntry
-	for i := range db.history {
-		if e := db.history[len(db.history)-1-i]; e.Matches(k) {
-			ret = append(ret, e)
+}
+
+func isPinned(he *baepi.BaeHistoryEntry) bool {
+	return he.Response != nil && he.Response.Pinned
+}
+
+func (hi *historyIndex) len() int {
+	return len(hi.entries)
+}
+
+// add appends an entry, evicting the oldest unpinned one in its channel if the
+// channel is full.
+func (hi *historyIndex) add(he *baepi.BaeHistoryEntry) {
+	if he.Response != nil && he.Response.Supersedes != "" {
+		if old := hi.find(he.Response.Supersedes); old != nil {
+			old.SupersededBy = he.ID
+		}
+	}
+	seq := hi.next
+	hi.next++
+	hi.entries[seq] = he
+	hi.byID[he.ID] = seq
+	if he.RepliedTo != nil {
+		hi.byUser[he.RepliedTo.ID] = append(hi.byUser[he.RepliedTo.ID], seq)
+	}
+	hi.byChannel[he.ChannelID] = append(hi.byChannel[he.ChannelID], seq)
+	if isPinned(he) {
+		hi.pinned[he.ChannelID]++
+	}
+	if seqs := hi.byChannel[he.ChannelID]; len(seqs)-hi.pinned[he.ChannelID] > hi.capacity {
+		for _, s := range seqs {
+			if !isPinned(hi.entries[s]) {
+				hi.evict(s)
+				break
+			}
 		}
-		if len(ret) >= n {
-			db.LogInfo("Terminating history search early.")
+	}
+}
+
+// find returns the live entry with the given ID, if any.
+func (hi *historyIndex) find(id string) *baepi.BaeHistoryEntry {
+	if seq, ok := hi.byID[id]; ok {
+		return hi.entries[seq]
+	}
+	return nil
+}
+
+// expire evicts entries said before the cutoff.
+func (hi *historyIndex) expire(cutoff time.Time) {
+	for ch, seqs := range hi.byChannel {
+		for len(seqs) > 0 && hi.entries[seqs[0]].TimeSaid.Before(cutoff) {
+			hi.evict(seqs[0])
+			seqs = hi.byChannel[ch]
+		}
+	}
+}
+
+func (hi *historyIndex) evict(seq uint64) {
+	he := hi.entries[seq]
+	delete(hi.entries, seq)
+	if hi.byID[he.ID] == seq {
+		delete(hi.byID, he.ID)
+	}
+	if he.RepliedTo != nil {
+		removeIndex(hi.byUser, he.RepliedTo.ID, seq)
+	}
+	removeIndex(hi.byChannel, he.ChannelID, seq)
+	if isPinned(he) {
+		if hi.pinned[he.ChannelID]--; hi.pinned[he.ChannelID] == 0 {
+			delete(hi.pinned, he.ChannelID)
+		}
+	}
+}
+
+// removeIndex removes seq from the index list for key, dropping the key
+// altogether once its list is empty.
+func removeIndex(idx map[string][]uint64, key string, seq uint64) {
+	seqs := idx[key]
+	i := sort.Search(len(seqs), func(i int) bool { return seqs[i] >= seq })
+	switch {
+	case i == len(seqs) || seqs[i] != seq:
+		return
+	case len(seqs) == 1:
+		delete(idx, key)
+	case i == 0:
+		// Usually it's the oldest, which is cheap to pop.
+		idx[key] = seqs[1:]
+	default:
+		idx[key] = append(seqs[:i:i], seqs[i+1:]...)
+	}
+}
+
+// candidates returns the sequence numbers, oldest to newest, of the smallest
+// index list that could satisfy k. A nil return with ok set to false means no
+// index applies and every entry needs to be considered.
+func (hi *historyIndex) candidates(k *baepi.BaeHistoKey) (seqs []uint64, ok bool) {
+	if k.BaestFriendID != "" {
+		seqs, ok = hi.byUser[k.BaestFriendID], true
+	}
+	if k.ChannelID != "" {
+		if cs := hi.byChannel[k.ChannelID]; !ok || len(cs) < len(seqs) {
+			seqs, ok = cs, true
+		}
+	}
+	return seqs, ok
+}
+
+// search returns up to n entries matching k from newest to oldest.
+func (hi *historyIndex) search(k *baepi.BaeHistoKey, n int) []*baepi.BaeHistoryEntry {
+	var ret []*baepi.BaeHistoryEntry
+	seqs, ok := hi.candidates(k)
+	if !ok {
+		seqs = hi.seqs()
+	}
+	for i := len(seqs) - 1; i >= 0; i-- {
+		he := hi.entries[seqs[i]]
+		// History is in time order, so nothing older than an entry before
+		// Since can match either.
+		if !k.Since.IsZero() && he.TimeSaid.Before(k.Since) {
 			break
 		}
+		if he.Matches(k) {
+			ret = append(ret, he)
+			if len(ret) == n {
+				break
+			}
+		}
 	}
 	return ret
 }
 
+// seqs returns the sequence number of every live entry from oldest to newest.
+func (hi *historyIndex) seqs() []uint64 {
+	ret := make([]uint64, 0, len(hi.entries))
+	for seq := range hi.entries {
+		ret = append(ret, seq)
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i] < ret[j] })
+	return ret
+}
+
+// all returns every live entry from oldest to newest.
+func (hi *historyIndex) all() []*baepi.BaeHistoryEntry {
+	ret := make([]*baepi.BaeHistoryEntry, 0, hi.len())
+	for _, seq := range hi.seqs() {
+		ret = append(ret, hi.entries[seq])
+	}
+	return ret
+}
+
+// FetchHistory returns up to n BaeHistoryEntries matching the constraints in
+// the given BaeHistoKey, from most recent to oldest. All fields in the key are
+// considered optional.
+func (db *diceBae) FetchHistory(k *baepi.BaeHistoKey, n int) []*baepi.BaeHistoryEntry {
+	if n > maxChannelHistory {
+		n = maxChannelHistory
+	}
+	db.historyMu.Lock()
+	defer db.historyMu.Unlock()
+	return db.history.search(k, n)
+}
+
+// initHistory opens the history store in the given directory and reloads
+// whatever history survived the last run.
+func (db *diceBae) initHistory(dataDir string) error {
+	hs, err := newHistoryStore(dataDir)
+	if err != nil {
+		return err
+	}
+	db.historyStore = hs
+	db.history = newHistoryIndex(maxChannelHistory)
+	hes, err := hs.load()
+	if err != nil {
+		return err
+	}
+	for _, he := range hes {
+		db.history.add(he)
+	}
+	db.history.expire(time.Now().Add(-maxHistoryAge))
+	db.LogInfo("Recovered %d of %d history entries.", db.history.len(), len(hes))
+	return db.maybeCompactHistory()
+}
+
 func (db *diceBae) appendToHistory(he *baepi.BaeHistoryEntry) {
-	// This implementation is currently very dumb, but is broken out here to make
-	// adding things like a per-channel or per-user index easier in the future.
-	db.history = append(db.history, he)
+	db.historyMu.Lock()
+	defer db.historyMu.Unlock()
+	db.history.add(he)
+	db.history.expire(he.TimeSaid.Add(-maxHistoryAge))
+	if err := db.historyStore.append(he); err != nil {
+		db.LogError("bae forgot what she said: %v", err)
+	}
+	if err := db.maybeCompactHistory(); err != nil {
+		db.LogError("bae couldn't tidy up her history: %v", err)
+	}
+}
+
+// maybeCompactHistory rewrites the history store with only the retained
+// entries once enough dropped entries have piled up in it. Callers must hold
+// historyMu.
+func (db *diceBae) maybeCompactHistory() error {
+	retained := db.history.len()
+	if retained < maxChannelHistory {
+		retained = maxChannelHistory
+	}
+	if db.historyStore.size() <= historyCompactionFactor*retained {
+		return nil
+	}
+	return db.historyStore.compact(db.history.all())
 }
@@ -0,0 +1,151 @@
+// Historystore persists the bae's history to disk so that it survives restarts.
+package dicebae
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+
+	"dicebae/baepi"
+)
+
+var (
+	historyFile = "history.jsonl"
+	// The on-disk log is compacted once it holds this many times the number of
+	// retained entries.
+	historyCompactionFactor = 2
+)
+
+// historyStore durably records BaeHistoryEntries so the bae's history can be
+// reloaded on startup.
+type historyStore interface {
+	// load returns all stored entries from oldest to newest.
+	load() ([]*baepi.BaeHistoryEntry, error)
+	// append records a single new entry.
+	append(*baepi.BaeHistoryEntry) error
+	// compact replaces the stored entries with the given, retained entries.
+	compact([]*baepi.BaeHistoryEntry) error
+	// size returns the number of entries currently in the store.
+	size() int
+	close() error
+}
+
+// memHistoryStore is used when the bae has nowhere to write. It stores nothing,
+// so history only lives as long as the process.
+type memHistoryStore struct{}
+
+func (memHistoryStore) load() ([]*baepi.BaeHistoryEntry, error) { return nil, nil }
+func (memHistoryStore) append(*baepi.BaeHistoryEntry) error     { return nil }
+func (memHistoryStore) compact([]*baepi.BaeHistoryEntry) error  { return nil }
+func (memHistoryStore) size() int                               { return 0 }
+func (memHistoryStore) close() error                            { return nil }
+
+// jsonlHistoryStore is an append-only log with one JSON-encoded
+// BaeHistoryEntry per line.
+type jsonlHistoryStore struct {
+	path    string
+	f       *os.File
+	entries int
+}
+
+func newHistoryStore(dataDir string) (historyStore, error) {
+	if dataDir == "" {
+		return memHistoryStore{}, nil
+	}
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create data dir %q: %v", dataDir, err)
+	}
+	hs := &jsonlHistoryStore{path: path.Join(dataDir, historyFile)}
+	f, err := os.OpenFile(hs.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file %q: %v", hs.path, err)
+	}
+	hs.f = f
+	return hs, nil
+}
+
+func (hs *jsonlHistoryStore) load() ([]*baepi.BaeHistoryEntry, error) {
+	f, err := os.Open(hs.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history file %q: %v", hs.path, err)
+	}
+	defer f.Close()
+
+	var ret []*baepi.BaeHistoryEntry
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for line := 1; sc.Scan(); line++ {
+		if len(sc.Bytes()) == 0 {
+			continue
+		}
+		he := &baepi.BaeHistoryEntry{}
+		if err := json.Unmarshal(sc.Bytes(), he); err != nil {
+			// A torn write from a crash shouldn't cost us the rest of history.
+			continue
+		}
+		ret = append(ret, he)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history file %q: %v", hs.path, err)
+	}
+	hs.entries = len(ret)
+	return ret, nil
+}
+
+func (hs *jsonlHistoryStore) append(he *baepi.BaeHistoryEntry) error {
+	b, err := json.Marshal(he)
+	if err != nil {
+		return fmt.Errorf("failed to marshal history entry: %v", err)
+	}
+	if _, err := hs.f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("failed to write history entry: %v", err)
+	}
+	hs.entries++
+	return nil
+}
+
+func (hs *jsonlHistoryStore) compact(hes []*baepi.BaeHistoryEntry) error {
+	// Write to a temp file and rename over the log so a crash mid-compaction
+	// leaves the old log intact.
+	tmpPath := hs.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return fmt.Errorf("failed to create %q: %v", tmpPath, err)
+	}
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, he := range hes {
+		if err := enc.Encode(he); err != nil {
+			tmp.Close()
+			return fmt.Errorf("failed to marshal history entry: %v", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %q: %v", tmpPath, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to close %q: %v", tmpPath, err)
+	}
+	if err := os.Rename(tmpPath, hs.path); err != nil {
+		return fmt.Errorf("failed to replace history file: %v", err)
+	}
+	hs.f.Close()
+	f, err := os.OpenFile(hs.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to reopen history file %q: %v", hs.path, err)
+	}
+	hs.f = f
+	hs.entries = len(hes)
+	return nil
+}
+
+func (hs *jsonlHistoryStore) size() int {
+	return hs.entries
+}
+
+func (hs *jsonlHistoryStore) close() error {
+	return hs.f.Close()
+}
@@ -0,0 +1,98 @@
+package player
+
+import (
+	"fmt"
+	"strings"
+)
+
+// announcement describes what's worth celebrating between an old and new
+// version of a character's sheet, like level-ups, new features, a new max HP
+// and ability score increases. It's empty if nothing is.
+func announcement(old, cs *CharacterSheet) string {
+	var news []string
+	leveled := cs.Level > old.Level
+	if leveled {
+		news = append(news, fmt.Sprintf("Level %d → %d (%s)", old.Level, cs.Level, cs.fmtClassChanges(old)))
+	}
+	if cs.TotalHP != old.TotalHP {
+		news = append(news, fmt.Sprintf("Max HP %d → %d", old.TotalHP, cs.TotalHP))
+	}
+	for _, ab := range []string{"str", "dex", "con", "int", "wis", "cha"} {
+		if o, n := old.Score(ab), cs.Score(ab); n > o {
+			news = append(news, fmt.Sprintf("%s %d → %d", abilityNames[ab], o, n))
+		}
+	}
+	was := make(map[string]string)
+	for _, c := range old.Classes {
+		was[c.Name] = c.Subclass
+	}
+	for _, c := range cs.Classes {
+		if c.Subclass != "" && c.Subclass != was[c.Name] {
+			news = append(news, fmt.Sprintf("New subclass: %s %s", c.Subclass, c.Name))
+		}
+	}
+	// Sheets cached before they named every feature only have limited-use
+	// ones, and the rest of them aren't new.
+	all := len(old.FeatureNames) > 0
+	had := make(map[string]bool)
+	for _, n := range old.featureNames(all) {
+		had[strings.ToLower(n)] = true
+	}
+	var features []string
+	for _, n := range cs.featureNames(all) {
+		if !had[strings.ToLower(n)] {
+			features = append(features, n)
+		}
+	}
+	if len(features) > 0 {
+		news = append(news, "New: "+strings.Join(features, ", "))
+	}
+	if len(news) == 0 {
+		return ""
+	}
+	headline := fmt.Sprintf("**%s got an upgrade!**", cs.PlayerName)
+	if leveled {
+		headline = fmt.Sprintf("**%s leveled up!** Look at them go.", cs.PlayerName)
+	}
+	return headline + "\n" + strings.Join(news, "\n")
+}
+
+// featureNames returns the names of the character's limited-use features, and
+// if all is set, every other feature too, ignoring repeats.
+func (cs *CharacterSheet) featureNames(all bool) []string {
+	var names []string
+	if all {
+		names = append(names, cs.FeatureNames...)
+	}
+	for _, f := range cs.Features {
+		names = append(names, f.Name)
+	}
+	seen := make(map[string]bool)
+	var ret []string
+	for _, n := range names {
+		if !seen[strings.ToLower(n)] {
+			seen[strings.ToLower(n)] = true
+			ret = append(ret, n)
+		}
+	}
+	return ret
+}
+
+// fmtClassChanges describes the classes a character gained levels in, like
+// "Fighter 5 → 6, Warlock 1".
+func (cs *CharacterSheet) fmtClassChanges(old *CharacterSheet) string {
+	was := make(map[string]int)
+	for _, c := range old.Classes {
+		was[c.Name] = c.Level
+	}
+	var ss []string
+	for _, c := range cs.Classes {
+		switch o := was[c.Name]; {
+		case o == 0:
+			ss = append(ss, fmt.Sprintf("new class: %s %d", c.Name, c.Level))
+		case c.Level > o:
+			ss = append(ss, fmt.Sprintf("%s %d → %d", c.Name, o, c.Level))
+		}
+	}
+	return strings.Join(ss, ", ")
+}
@@ -0,0 +1,44 @@
+package player
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAnnouncement(t *testing.T) {
+	fighter := func(level int, subclass string, features ...string) *CharacterSheet {
+		return &CharacterSheet{
+			PlayerName:   "Brakka",
+			Level:        level,
+			Classes:      []ClassLevel{{Name: "Fighter", Subclass: subclass, Level: level}},
+			FeatureNames: features,
+			Features:     []*Feature{{Name: "Second Wind", MaxUses: 1}},
+		}
+	}
+	for _, tc := range []struct {
+		desc     string
+		old, cs  *CharacterSheet
+		want     []string
+		dontWant []string
+	}{
+		{"nothing", fighter(2, "", "Second Wind"), fighter(2, "", "Second Wind"), nil, nil},
+		{"subclass", fighter(2, "", "Second Wind", "Action Surge"), fighter(3, "Champion", "Second Wind", "action surge", "Improved Critical"),
+			[]string{"leveled up", "Fighter 2 → 3", "New subclass: Champion Fighter", "New: Improved Critical"}, []string{"Action Surge"}},
+		{"old cache", fighter(2, ""), fighter(2, "", "Second Wind", "Action Surge"), nil, nil},
+	} {
+		got := announcement(tc.old, tc.cs)
+		if len(tc.want) == 0 && got != "" {
+			t.Errorf("%s: announcement() = %q, want nothing", tc.desc, got)
+		}
+		for _, w := range tc.want {
+			if !strings.Contains(got, w) {
+				t.Errorf("%s: announcement() = %q, want it to mention %q", tc.desc, got, w)
+			}
+		}
+		for _, w := range tc.dontWant {
+			if strings.Contains(got, w) {
+				t.Errorf("%s: announcement() = %q, don't want it to mention %q", tc.desc, got, w)
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package player
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// cachedJSON is a character's raw D&D Beyond JSON along with what's needed to
+// ask D&D Beyond whether it has changed.
+type cachedJSON struct {
+	FetchedAt    time.Time       `json:"fetchedAt"`
+	ETag         string          `json:"etag,omitempty"`
+	LastModified string          `json:"lastModified,omitempty"`
+	Body         json.RawMessage `json:"body"`
+}
+
+// sheetCache keeps the latest JSON of each character in memory and, if it has
+// a directory, on disk so that the bae can start while D&D Beyond is down.
+type sheetCache struct {
+	dir     string
+	mu      sync.Mutex
+	entries map[int]*cachedJSON
+}
+
+// newSheetCache returns a cache backed by the given directory, loading any
+// previously cached characters from it. An empty dir caches in memory only.
+func newSheetCache(dir string) (*sheetCache, error) {
+	sc := &sheetCache{dir: dir, entries: make(map[int]*cachedJSON)}
+	if dir == "" {
+		return sc, nil
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache dir %q: %v", dir, err)
+	}
+	fis, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cache dir %q: %v", dir, err)
+	}
+	for _, fi := range fis {
+		id, err := strconv.Atoi(strings.TrimSuffix(fi.Name(), ".json"))
+		if err != nil || !strings.HasSuffix(fi.Name(), ".json") {
+			continue
+		}
+		b, err := ioutil.ReadFile(path.Join(dir, fi.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read cached character %d: %v", id, err)
+		}
+		cj := &cachedJSON{}
+		if err := json.Unmarshal(b, cj); err != nil {
+			// A corrupt entry just means a refetch.
+			continue
+		}
+		sc.entries[id] = cj
+	}
+	return sc, nil
+}
+
+func (sc *sheetCache) get(id int) *cachedJSON {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	return sc.entries[id]
+}
+
+func (sc *sheetCache) put(id int, cj *cachedJSON) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.entries[id] = cj
+	if sc.dir == "" {
+		return nil
+	}
+	b, err := json.Marshal(cj)
+	if err != nil {
+		return fmt.Errorf("failed to marshal cached character %d: %v", id, err)
+	}
+	return writeFileAtomic(path.Join(sc.dir, fmt.Sprintf("%d.json", id)), b)
+}
@@ -0,0 +1,156 @@
+package player
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"dicebae/baepi"
+	"dicebae/roll"
+)
+
+var (
+	spellLevelRegexp = regexp.MustCompile(`^(\d)(?:st|nd|rd|th)?$`)
+)
+
+// SlotsHandler returns a handler for "!slots [character] [reset]", showing the
+// character's remaining spell slots, or restoring them all.
+func (ph *PlayerHandler) SlotsHandler() baepi.BaeSayHandler {
+	return &command{hotword: "slots", say: ph.slots}
+}
+
+func (ph *PlayerHandler) slots(db baepi.DiceBae, e *baepi.Baevent, args []string) (*baepi.Baesponse, error) {
+	key, cs, args, missing := ph.whose(e, args)
+	if missing != nil {
+		return missing, nil
+	}
+	if len(args) > 0 && strings.ToLower(args[0]) == "reset" {
+		if err := ph.overlays.update(key, resetSlots); err != nil {
+			return nil, err
+		}
+	}
+	return say(cs.fmtSlots(ph.overlays.get(key))), nil
+}
+
+// resetSlots restores every spent spell slot.
+func resetSlots(o *overlay) error {
+	o.SlotsUsed = [9]int{}
+	o.PactUsed = 0
+	return nil
+}
+
+// fmtSlots formats the character's remaining spell slots.
+func (cs *CharacterSheet) fmtSlots(o overlay) string {
+	var ss []string
+	for i, n := range cs.SpellSlots {
+		if n > 0 {
+			ss = append(ss, fmt.Sprintf("%s %d/%d", ordinal(i+1), n-o.SlotsUsed[i], n))
+		}
+	}
+	if cs.PactSlots > 0 {
+		ss = append(ss, fmt.Sprintf("Pact (%s) %d/%d", ordinal(cs.PactSlotLevel), cs.PactSlots-o.PactUsed, cs.PactSlots))
+	}
+	if len(ss) == 0 {
+		return fmt.Sprintf("%s can't cast spells, or at least not with slots.", cs.PlayerName)
+	}
+	return fmt.Sprintf("**%s's spell slots:** %s", cs.PlayerName, strings.Join(ss, ", "))
+}
+
+// CastHandler returns a handler for "!cast [character] [level] [spell]",
+// spending a spell slot and rolling the spell's damage, if it has any.
+func (ph *PlayerHandler) CastHandler() baepi.BaeSayHandler {
+	return &command{hotword: "cast", say: ph.cast}
+}
+
+func (ph *PlayerHandler) cast(db baepi.DiceBae, e *baepi.Baevent, args []string) (*baepi.Baesponse, error) {
+	key, cs, rest, missing := ph.whose(e, args)
+	if missing != nil {
+		return missing, nil
+	}
+	if len(rest) < 1 {
+		return say("Try !cast [character] [level] [spell], e.g., !cast kira 3 fireball."), nil
+	}
+	level := -1
+	if sub := spellLevelRegexp.FindStringSubmatch(strings.ToLower(rest[0])); sub != nil {
+		level, _ = strconv.Atoi(sub[1])
+		rest = rest[1:]
+	}
+	var sp *Spell
+	if len(rest) > 0 {
+		var err error
+		if sp, err = cs.findSpell(strings.Join(rest, " ")); err != nil {
+			return say(err.Error() + "."), nil
+		}
+		if level < 0 {
+			level = sp.Level
+		}
+		if level < sp.Level {
+			return say(fmt.Sprintf("%s is a %s-level spell, you can't cast it with a %s-level slot.",
+				sp.Name, ordinal(sp.Level), ordinal(level))), nil
+		}
+	}
+	if level < 0 {
+		return say("Cast what, at what level?"), nil
+	}
+
+	what := "a spell"
+	if sp != nil {
+		what = sp.Name
+	}
+	msg := fmt.Sprintf("%s casts %s", cs.PlayerName, what)
+	if level > 0 {
+		var left string
+		err := ph.overlays.update(key, func(o *overlay) error {
+			var err error
+			left, level, err = cs.spendSlot(o, level)
+			return err
+		})
+		if err != nil {
+			return say(err.Error() + "."), nil
+		}
+		msg += fmt.Sprintf(" at %s level (%s)", ordinal(level), left)
+	}
+
+	if sp == nil || sp.Damage == "" {
+		return say(msg + "."), nil
+	}
+	reqs, err := sp.damageAt(level, cs.Level)
+	if err != nil {
+		return nil, fmt.Errorf("bad damage dice for %s: %v", sp.Name, err)
+	}
+	ph.rngMu.Lock()
+	resp := roll.RollAll(ph.rng, reqs)
+	ph.rngMu.Unlock()
+	resp.Label = msg
+	if sp.DamageType != "" {
+		resp.Label += ", " + sp.DamageType + " damage"
+	}
+	return &baepi.Baesponse{
+		Message:         resp.String(),
+		MentionUser:     true,
+		HandlerMetadata: resp,
+	}, nil
+}
+
+// spendSlot spends a spell slot of at least the given level, preferring pact
+// magic since it comes back sooner. Pact slots are always cast at their own
+// level, so when there's no regular slot of the level but a higher pact slot
+// is free, the spell is upcast. It returns what's left of the slots it used
+// and the level the spell is cast at.
+func (cs *CharacterSheet) spendSlot(o *overlay, level int) (string, int, error) {
+	if level > len(cs.SpellSlots) {
+		return "", 0, fmt.Errorf("there's no such thing as a %s-level slot", ordinal(level))
+	}
+	pactFree := cs.PactSlotLevel >= level && o.PactUsed < cs.PactSlots
+	max := cs.SpellSlots[level-1]
+	if pactFree && (cs.PactSlotLevel == level || o.SlotsUsed[level-1] >= max) {
+		o.PactUsed++
+		return fmt.Sprintf("%d/%d pact slots left", cs.PactSlots-o.PactUsed, cs.PactSlots), cs.PactSlotLevel, nil
+	}
+	if o.SlotsUsed[level-1] >= max {
+		return "", 0, fmt.Errorf("%s is out of %s-level slots", cs.PlayerName, ordinal(level))
+	}
+	o.SlotsUsed[level-1]++
+	return fmt.Sprintf("%d/%d %s-level slots left", max-o.SlotsUsed[level-1], max, ordinal(level)), level, nil
+}
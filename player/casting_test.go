@@ -0,0 +1,42 @@
+package player
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSpendSlot(t *testing.T) {
+	// A paladin 5 / warlock 3: two 1st- and two 2nd-level slots, plus two
+	// 2nd-level pact slots.
+	cs := &CharacterSheet{PlayerName: "Kira", SpellSlots: [9]int{2, 2}, PactSlots: 2, PactSlotLevel: 2}
+	for _, tc := range []struct {
+		desc      string
+		used      overlay
+		level     int
+		wantLeft  string
+		wantLevel int
+		wantErr   string
+		wantUsed  overlay
+	}{
+		{"regular slot first", overlay{}, 1, "1/2 1st-level slots left", 1, "", overlay{SlotsUsed: [9]int{1}}},
+		{"pact slot at its level", overlay{}, 2, "1/2 pact slots left", 2, "", overlay{PactUsed: 1}},
+		{"regular slot once pact's gone", overlay{PactUsed: 2}, 2, "1/2 2nd-level slots left", 2, "", overlay{SlotsUsed: [9]int{0, 1}, PactUsed: 2}},
+		{"pact upcast", overlay{SlotsUsed: [9]int{2}}, 1, "1/2 pact slots left", 2, "", overlay{SlotsUsed: [9]int{2}, PactUsed: 1}},
+		{"out of everything", overlay{SlotsUsed: [9]int{2}, PactUsed: 2}, 1, "", 0, "Kira is out of 1st-level slots", overlay{SlotsUsed: [9]int{2}, PactUsed: 2}},
+		{"no slots that high", overlay{}, 3, "", 0, "Kira is out of 3rd-level slots", overlay{}},
+		{"no such level", overlay{}, 10, "", 0, "there's no such thing as a 10th-level slot", overlay{}},
+	} {
+		o := tc.used
+		left, level, err := cs.spendSlot(&o, tc.level)
+		if tc.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("%s: spendSlot() = %v, want an error with %q", tc.desc, err, tc.wantErr)
+			}
+		} else if err != nil || left != tc.wantLeft || level != tc.wantLevel {
+			t.Errorf("%s: spendSlot() = %q, %d, %v, want %q, %d", tc.desc, left, level, err, tc.wantLeft, tc.wantLevel)
+		}
+		if o.SlotsUsed != tc.wantUsed.SlotsUsed || o.PactUsed != tc.wantUsed.PactUsed {
+			t.Errorf("%s: got %v used and %d pact used, want %v and %d", tc.desc, o.SlotsUsed, o.PactUsed, tc.wantUsed.SlotsUsed, tc.wantUsed.PactUsed)
+		}
+	}
+}
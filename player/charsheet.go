@@ -2,14 +2,35 @@ package player
 
 import (
 	"fmt"
+	"strings"
 )
 
 type CharacterSheet struct {
 	PlayerName string
-	Class      string
-	Level      int
-	CurrentHP  int
-	TotalHP    int
+	// Class names every class the character has, and Level is their total
+	// level in all of them.
+	Class     string
+	Level     int
+	Classes   []ClassLevel
+	CurrentHP int
+	TotalHP   int
+	TempHP    int
+	AC        int
+	// Speed is the character's walking speed in feet.
+	Speed int
+	// InitiativeBonus and PassiveBonuses hold bonuses on top of the usual
+	// checks, e.g., from the Alert and Observant feats.
+	InitiativeBonus int
+	PassiveBonuses  map[string]int
+	// SpellSaveDCBonus is a flat bonus to spell save DCs, e.g., from a Rod of
+	// the Pact Keeper.
+	SpellSaveDCBonus int
+
+	// Resistances, Immunities and Vulnerabilities hold damage types, e.g.,
+	// "fire".
+	Resistances     map[string]bool
+	Immunities      map[string]bool
+	Vulnerabilities map[string]bool
 
 	Str int
 	Dex int
@@ -18,8 +39,43 @@ type CharacterSheet struct {
 	Wis int
 	Cha int
 
-	//TODO: Proficiency []string
-	//TODO: Spell Slots []string
+	// Skills holds the skills the character has any proficiency in.
+	Skills          map[string]Proficiency
+	JackOfAllTrades bool
+	// SaveProficiencies holds the abilities, e.g., "dex", the character is
+	// proficient in saving throws for.
+	SaveProficiencies map[string]bool
+	// SaveBonuses holds flat bonuses to saving throws by ability, with "all"
+	// for bonuses to every save, e.g., from a Cloak of Protection.
+	SaveBonuses map[string]int
+	// CheckBonus is a flat bonus to every ability check.
+	CheckBonus int
+
+	Weapons []*Weapon
+	// OtherProficiencies holds weapon, armor and tool proficiencies by their
+	// D&D Beyond subtype, e.g., "martial-weapons" or "hand-crossbow".
+	OtherProficiencies map[string]bool
+	// AttackBonuses holds flat bonuses to "melee", "ranged" or "all" weapon
+	// attacks, e.g., from the Archery fighting style.
+	AttackBonuses map[string]int
+
+	// SpellSlots holds the number of slots of each spell level, from 1st at
+	// index 0 to 9th. Pact magic slots are kept apart since they come back on
+	// a short rest.
+	SpellSlots    [9]int
+	PactSlots     int
+	PactSlotLevel int
+	Spells        []*Spell
+
+	Features []*Feature
+	// FeatureNames names every class, subclass and racial feature and feat
+	// the character has, limited-use or not.
+	FeatureNames []string
+	Items        []*Item
+	Coins        Coins
+	// Conditions holds the character's conditions and their levels, as
+	// tracked by the bae.
+	Conditions map[string]int
 }
 
 func fmtStat(stat int) string {
@@ -41,9 +97,27 @@ func (cs *CharacterSheet) String() string {
 		fmtStat(cs.Str), fmtStat(cs.Dex), fmtStat(cs.Con),
 		fmtStat(cs.Int), fmtStat(cs.Wis), fmtStat(cs.Cha),
 	)
-	return fmt.Sprintf(
-		"**%s:** Level %d %s, %d/%d HP\n%s", cs.PlayerName, cs.Level, cs.Class, cs.CurrentHP, cs.TotalHP, stats,
+	hp := fmt.Sprintf("%d/%d HP", cs.CurrentHP, cs.TotalHP)
+	if cs.TempHP > 0 {
+		hp += fmt.Sprintf(" (+%d temp)", cs.TempHP)
+	}
+	derived := fmt.Sprintf("Init %+d, Prof %+d, Passive Perception %d, Insight %d, Investigation %d",
+		cs.Initiative(), cs.ProficiencyBonus(),
+		cs.Passive("perception"), cs.Passive("insight"), cs.Passive("investigation"),
+	)
+	if cs.Speed > 0 {
+		derived = fmt.Sprintf("Speed %d ft, %s", cs.Speed, derived)
+	}
+	if cs.AC > 0 {
+		derived = fmt.Sprintf("AC %d, %s", cs.AC, derived)
+	}
+	s := fmt.Sprintf(
+		"**%s:** %s, %s\n%s\n%s", cs.PlayerName, cs.fmtClasses(), hp, stats, derived,
 	)
+	if len(cs.Conditions) > 0 {
+		s += "\nConditions: " + fmtConditions(cs.Conditions)
+	}
+	return s
 }
 
 func newCharacterSheet(p *DNDBeyondJSON) *CharacterSheet {
@@ -52,15 +126,8 @@ func newCharacterSheet(p *DNDBeyondJSON) *CharacterSheet {
 		statmap[s.ID] = s.Value
 	}
 
-	var pc PlayerClass
-	if len(p.Classes) > 0 {
-		pc = p.Classes[0]
-	}
-
 	cs := &CharacterSheet{
 		PlayerName: p.Name,
-		Class:      pc.Definition.Name,
-		Level:      pc.Level,
 		Str:        statmap[1],
 		Dex:        statmap[2],
 		Con:        statmap[3],
@@ -68,30 +135,55 @@ func newCharacterSheet(p *DNDBeyondJSON) *CharacterSheet {
 		Wis:        statmap[5],
 		Cha:        statmap[6],
 	}
+	cs.setClasses(p)
 
-	for _, mod := range append(p.Modifiers.Race, p.Modifiers.Class...) {
-		switch mod.SubType {
-		case "strength-score":
-			cs.Str += mod.Value
-		case "dexterity-score":
-			cs.Dex += mod.Value
-		case "constitution-score":
-			cs.Con += mod.Value
-		case "intelligence-score":
-			cs.Int += mod.Value
-		case "wisdom-score":
-			cs.Wis += mod.Value
-		case "charisma-score":
-			cs.Cha += mod.Value
+	mods := p.activeModifiers()
+	for _, mod := range mods {
+		switch mod.Type {
+		case "proficiency":
+			cs.addProficiency(mod.SubType, Proficient)
+			cs.addOtherProficiency(mod.SubType)
+		case "expertise":
+			cs.addProficiency(mod.SubType, Expertise)
+		case "half-proficiency":
+			if mod.SubType == "ability-checks" {
+				cs.JackOfAllTrades = true
+			}
+		case "bonus":
+			switch {
+			case mod.SubType == "saving-throws":
+				cs.addSaveBonus("all", mod.Value)
+			case mod.SubType == "ability-checks":
+				cs.CheckBonus += mod.Value
+			case strings.HasSuffix(mod.SubType, "-saving-throws"):
+				cs.addSaveBonus(abilityKey(strings.TrimSuffix(mod.SubType, "-saving-throws")), mod.Value)
+			case mod.SubType == "weapon-attacks":
+				cs.addAttackBonus("all", mod.Value)
+			case mod.SubType == "melee-weapon-attacks":
+				cs.addAttackBonus("melee", mod.Value)
+			case mod.SubType == "ranged-weapon-attacks":
+				cs.addAttackBonus("ranged", mod.Value)
+			}
+		case "resistance", "immunity", "vulnerability":
+			cs.addDefense(mod.Type, mod.SubType)
+		}
+		if mod.Type == "proficiency" && strings.HasSuffix(mod.SubType, "-saving-throws") {
+			cs.addSaveProficiency(abilityKey(strings.TrimSuffix(mod.SubType, "-saving-throws")))
 		}
 	}
 
-	hp := p.BaseHitPoints
-	conMod := (cs.Con - 10) / 2
-	hp += conMod * cs.Level
+	cs.derive(p, mods)
+	cs.setFeatures(p)
 
-	cs.TotalHP = hp
-	cs.CurrentHP = hp - p.RemovedHitPoints
+	cs.setSpellSlots(p)
+	cs.setSpells(p)
+
+	for i := range p.Inventory {
+		if w := cs.newWeapon(&p.Inventory[i]); w != nil {
+			cs.Weapons = append(cs.Weapons, w)
+		}
+	}
+	cs.setInventory(p)
 
 	return cs
 }
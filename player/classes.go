@@ -0,0 +1,157 @@
+package player
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ClassLevel is one of a character's classes and their levels in it.
+type ClassLevel struct {
+	Name     string
+	Subclass string
+	Level    int
+	// HitDie is the size of the class's hit dice, e.g., 10 for a d10.
+	HitDie int
+	// SpellAbility is the class's spellcasting ability, e.g., "int", if it
+	// has one.
+	SpellAbility string
+}
+
+// classHitDice holds the hit die of each class, for sheets that don't say.
+var classHitDice = map[string]int{
+	"artificer": 8,
+	"barbarian": 12,
+	"bard":      8,
+	"cleric":    8,
+	"druid":     8,
+	"fighter":   10,
+	"monk":      8,
+	"paladin":   10,
+	"ranger":    10,
+	"rogue":     8,
+	"sorcerer":  6,
+	"warlock":   8,
+	"wizard":    6,
+}
+
+// multiclassSpellSlots is the Multiclass Spellcaster table, holding the slots
+// of each spell level from 1st to 9th by combined caster level.
+var multiclassSpellSlots = [][9]int{
+	{},
+	{2},
+	{3},
+	{4, 2},
+	{4, 3},
+	{4, 3, 2},
+	{4, 3, 3},
+	{4, 3, 3, 1},
+	{4, 3, 3, 2},
+	{4, 3, 3, 3, 1},
+	{4, 3, 3, 3, 2},
+	{4, 3, 3, 3, 2, 1},
+	{4, 3, 3, 3, 2, 1},
+	{4, 3, 3, 3, 2, 1, 1},
+	{4, 3, 3, 3, 2, 1, 1},
+	{4, 3, 3, 3, 2, 1, 1, 1},
+	{4, 3, 3, 3, 2, 1, 1, 1},
+	{4, 3, 3, 3, 2, 1, 1, 1, 1},
+	{4, 3, 3, 3, 3, 1, 1, 1, 1},
+	{4, 3, 3, 3, 3, 2, 1, 1, 1},
+	{4, 3, 3, 3, 3, 2, 2, 1, 1},
+}
+
+// setClasses fills in the character's classes, with their starting class
+// first, and their total level.
+func (cs *CharacterSheet) setClasses(p *DNDBeyondJSON) {
+	pcs := append([]PlayerClass(nil), p.Classes...)
+	sort.SliceStable(pcs, func(i, j int) bool {
+		return pcs[i].IsStartingClass && !pcs[j].IsStartingClass
+	})
+	for _, pc := range pcs {
+		cl := ClassLevel{
+			Name:   pc.Definition.Name,
+			Level:  pc.Level,
+			HitDie: pc.Definition.HitDice,
+		}
+		cl.SpellAbility = statAbility(pc.Definition.SpellCastingAbilityID)
+		if pc.SubclassDefinition != nil {
+			cl.Subclass = pc.SubclassDefinition.Name
+			// Subclasses like the Eldritch Knight grant spellcasting themselves.
+			if cl.SpellAbility == "" {
+				cl.SpellAbility = statAbility(pc.SubclassDefinition.SpellCastingAbilityID)
+			}
+		}
+		cs.addClass(cl)
+	}
+}
+
+// addClass adds one of the character's classes, guessing its hit die if need
+// be, and counts it toward their level.
+func (cs *CharacterSheet) addClass(cl ClassLevel) {
+	if cl.HitDie == 0 {
+		cl.HitDie = classHitDice[strings.ToLower(cl.Name)]
+	}
+	cs.Classes = append(cs.Classes, cl)
+	cs.Level += cl.Level
+	var names []string
+	for _, c := range cs.Classes {
+		names = append(names, c.Name)
+	}
+	cs.Class = strings.Join(names, " / ")
+}
+
+// HitDice returns the character's hit dice pools, as the number of dice of
+// each size.
+func (cs *CharacterSheet) HitDice() map[int]int {
+	hd := make(map[int]int)
+	for _, c := range cs.Classes {
+		if c.HitDie > 0 {
+			hd[c.HitDie] += c.Level
+		}
+	}
+	return hd
+}
+
+// fmtClasses formats the character's classes like "Fighter 5 / Warlock 3", or
+// "Level 5 Fighter" if they only have the one.
+func (cs *CharacterSheet) fmtClasses() string {
+	if len(cs.Classes) < 2 {
+		return fmt.Sprintf("Level %d %s", cs.Level, cs.Class)
+	}
+	var ss []string
+	for _, c := range cs.Classes {
+		ss = append(ss, c.Name+" "+strconv.Itoa(c.Level))
+	}
+	return strings.Join(ss, " / ")
+}
+
+// SpellSaveDC returns the character's best spell save DC, or 0 if they can't
+// cast spells.
+func (cs *CharacterSheet) SpellSaveDC() int {
+	best := 0
+	for _, c := range cs.Classes {
+		if c.SpellAbility == "" {
+			continue
+		}
+		if dc := 8 + cs.ProficiencyBonus() + cs.Mod(c.SpellAbility) + cs.SpellSaveDCBonus; dc > best {
+			best = dc
+		}
+	}
+	return best
+}
+
+// casterLevel returns a class's contribution to a multiclass character's
+// combined spellcasting level.
+func casterLevel(pc *PlayerClass) int {
+	rules := pc.Definition.SpellRules
+	if rules == nil || rules.MultiClassSpellSlotDivisor == 0 {
+		return 0
+	}
+	d := rules.MultiClassSpellSlotDivisor
+	if rules.MultiClassSpellSlotRounding == roundUp {
+		return (pc.Level + d - 1) / d
+	}
+	return pc.Level / d
+}
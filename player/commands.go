@@ -0,0 +1,269 @@
+package player
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"dicebae/baepi"
+	"dicebae/roll"
+)
+
+// command is a BaeSayHandler for a single !hotword that works with the
+// PlayerHandler's characters. Commands that roll dice reply with a
+// roll.RollResponse, so they can share the "roll" history with regular rolls.
+type command struct {
+	hotword string
+	say     func(db baepi.DiceBae, e *baepi.Baevent, args []string) (*baepi.Baesponse, error)
+}
+
+func (c *command) ShouldSay(db baepi.DiceBae, e *baepi.Baevent) bool {
+	return e.Message == "!"+c.hotword || strings.HasPrefix(e.Message, "!"+c.hotword+" ")
+}
+
+func (c *command) SayWithBae(db baepi.DiceBae, e *baepi.Baevent) (*baepi.Baesponse, error) {
+	return c.say(db, e, strings.Fields(e.Message)[1:])
+}
+
+// CheckHandler returns a handler for "!check [character] <skill|ability>
+// [adv|dis]".
+func (ph *PlayerHandler) CheckHandler() baepi.BaeSayHandler {
+	return &command{hotword: "check", say: ph.check}
+}
+
+func (ph *PlayerHandler) check(db baepi.DiceBae, e *baepi.Baevent, args []string) (*baepi.Baesponse, error) {
+	args, adv := parseAdvantage(args)
+	key, cs, args, missing := ph.whose(e, args)
+	if missing != nil {
+		return missing, nil
+	}
+	if len(args) < 1 {
+		return say("Try !check [character] <skill|ability> [adv|dis]."), nil
+	}
+	fx := ph.effectsOn(key, checkRoll, "")
+	if ab := abilityKey(args[0]); ab != "" && len(args) == 1 {
+		return ph.rollD20(cs.AbilityCheckBonus(ab), adv, fx, fmt.Sprintf("%s's %s check", cs.PlayerName, abilityNames[ab])), nil
+	}
+	skill, err := findSkill(args)
+	if err != nil {
+		return say(err.Error() + "."), nil
+	}
+	return ph.rollD20(cs.SkillBonus(skill), adv, fx, fmt.Sprintf("%s's %s check", cs.PlayerName, skillTitle(skill))), nil
+}
+
+// SaveHandler returns a handler for "!save [character] <ability> [vs DC]
+// [adv|dis]".
+func (ph *PlayerHandler) SaveHandler() baepi.BaeSayHandler {
+	return &command{hotword: "save", say: ph.save}
+}
+
+func (ph *PlayerHandler) save(db baepi.DiceBae, e *baepi.Baevent, args []string) (*baepi.Baesponse, error) {
+	args, adv := parseAdvantage(args)
+	args, dc, err := parseDC(args)
+	if err != nil {
+		return say(err.Error() + "."), nil
+	}
+	key, cs, args, missing := ph.whose(e, args)
+	if missing != nil {
+		return missing, nil
+	}
+	if len(args) != 1 {
+		return say("Try !save [character] <ability> [vs DC] [adv|dis]."), nil
+	}
+	ab := abilityKey(args[0])
+	if ab == "" {
+		return say(fmt.Sprintf("%q isn't an ability.", args[0])), nil
+	}
+	label := fmt.Sprintf("%s's %s save", cs.PlayerName, abilityNames[ab])
+	if dc > 0 {
+		label += fmt.Sprintf(" vs DC %d", dc)
+	}
+	fx := ph.effectsOn(key, saveRoll, ab)
+	if fx.autoFail != "" {
+		return say(fmt.Sprintf("%s is %s, so they automatically fail %s saves.", cs.PlayerName, fx.autoFail, abilityNames[ab])), nil
+	}
+	resp := ph.rollD20(cs.SaveBonus(ab), adv, fx, label)
+	if dc > 0 {
+		if resp.HandlerMetadata.(roll.RollResponse).Total >= dc {
+			resp.Message += " **Saved!**"
+		} else {
+			resp.Message += " **Failed.**"
+		}
+	}
+	return resp, nil
+}
+
+// parseDC strips a "vs 15" or "dc 15" argument, returning what's left and the
+// DC, or zero if none was given.
+func parseDC(args []string) ([]string, int, error) {
+	var ret []string
+	var dc int
+	for i := 0; i < len(args); i++ {
+		switch a := strings.ToLower(args[i]); {
+		case (a == "vs" || a == "dc") && i+1 < len(args):
+			v, err := strconv.Atoi(strings.TrimPrefix(strings.ToLower(args[i+1]), "dc"))
+			if err != nil {
+				return nil, 0, fmt.Errorf("%q isn't a DC", args[i+1])
+			}
+			dc = v
+			i++
+		case strings.HasPrefix(a, "dc") && len(a) > 2:
+			v, err := strconv.Atoi(a[2:])
+			if err != nil {
+				return nil, 0, fmt.Errorf("%q isn't a DC", args[i])
+			}
+			dc = v
+		default:
+			ret = append(ret, args[i])
+		}
+	}
+	return ret, dc, nil
+}
+
+// lookup returns the key and sheet of the named character in a guild's party,
+// or a nil sheet if there's no such character or their sheet hasn't loaded. If
+// the name could be several characters, it returns their names instead.
+func (ph *PlayerHandler) lookup(guildID, name string) (string, *CharacterSheet, []string) {
+	return ph.find(guildID, name, nearMisses)
+}
+
+// find is lookup, only counting matches up to level.
+func (ph *PlayerHandler) find(guildID, name string, level matchLevel) (string, *CharacterSheet, []string) {
+	inParty := ph.inParty(guildID)
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	found := ph.names.resolve(name, inParty, level)
+	if len(found) > 1 {
+		var names []string
+		for _, cn := range found {
+			names = append(names, cn.display)
+		}
+		return "", nil, names
+	}
+	if len(found) == 0 || ph.characters[found[0].key] == nil {
+		return "", nil, nil
+	}
+	return found[0].key, ph.characters[found[0].key].sheet, nil
+}
+
+// rollD20 rolls a d20 with the given modifier and the effects of the roller's
+// conditions, and labels the result.
+func (ph *PlayerHandler) rollD20(mod int, adv roll.Advantage, fx rollEffects, label string) *baepi.Baesponse {
+	ph.rngMu.Lock()
+	resp := roll.RollAll(ph.rng, fx.apply(mod, adv))
+	ph.rngMu.Unlock()
+	onlyD20Crits(&resp)
+	resp.Label = fx.label(label)
+	return &baepi.Baesponse{
+		Message:         resp.String(),
+		MentionUser:     true,
+		HandlerMetadata: resp,
+	}
+}
+
+// damageRequests parses a weapon's damage, which is either dice or, like an
+// unarmed strike's 1, a flat amount with no dice at all.
+func damageRequests(dice string) ([]*roll.RollRequest, error) {
+	if n, err := strconv.Atoi(strings.TrimSpace(dice)); err == nil {
+		return []*roll.RollRequest{{Modifier: n}}, nil
+	}
+	reqs, err := roll.ParseRollRequests(dice)
+	if err == nil && len(reqs) == 0 {
+		err = fmt.Errorf("no dice in %q", dice)
+	}
+	return reqs, err
+}
+
+// parseAdvantage strips an "adv" or "dis" argument, returning what's left.
+func parseAdvantage(args []string) ([]string, roll.Advantage) {
+	var ret []string
+	adv := roll.NoAdvantage
+	for _, a := range args {
+		switch strings.ToLower(a) {
+		case "adv", "advantage":
+			adv = roll.WithAdvantage
+		case "dis", "disadv", "disadvantage":
+			adv = roll.WithDisadvantage
+		default:
+			ret = append(ret, a)
+		}
+	}
+	return ret, adv
+}
+
+func say(msg string) *baepi.Baesponse {
+	return &baepi.Baesponse{Message: msg, MentionUser: true}
+}
+
+// AttackHandler returns a handler for "!attack [character] <weapon> [2h]
+// [adv|dis]", rolling to hit and then damage, doubling damage dice on a crit.
+func (ph *PlayerHandler) AttackHandler() baepi.BaeSayHandler {
+	return &command{hotword: "attack", say: ph.attack}
+}
+
+func (ph *PlayerHandler) attack(db baepi.DiceBae, e *baepi.Baevent, args []string) (*baepi.Baesponse, error) {
+	args, adv := parseAdvantage(args)
+	var rest []string
+	twoHanded := false
+	for _, a := range args {
+		switch strings.ToLower(a) {
+		case "2h", "two-handed", "versatile":
+			twoHanded = true
+		default:
+			rest = append(rest, a)
+		}
+	}
+	key, cs, rest, missing := ph.whose(e, rest)
+	if missing != nil {
+		return missing, nil
+	}
+	if len(rest) < 1 {
+		return say("Try !attack [character] <weapon> [2h] [adv|dis]."), nil
+	}
+	w, err := cs.findWeapon(strings.Join(rest, " "))
+	if err != nil {
+		return say(err.Error() + "."), nil
+	}
+
+	dice, types := w.Damage, []string{w.DamageType}
+	if twoHanded && w.Versatile != "" {
+		dice = w.Versatile
+	}
+	reqs, err := damageRequests(dice)
+	if err != nil {
+		return say(fmt.Sprintf("%s does %q damage, and I don't know how to roll that.", w.Name, dice)), nil
+	}
+	reqs[0].Modifier += cs.DamageBonus(w)
+	for _, x := range w.Extra {
+		xreqs, err := damageRequests(x.Dice)
+		if err != nil {
+			return say(fmt.Sprintf("%s does %q extra damage, and I don't know how to roll that.", w.Name, x.Dice)), nil
+		}
+		reqs = append(reqs, xreqs...)
+		types = append(types, x.Type)
+	}
+
+	fx := ph.effectsOn(key, attackRoll, "")
+	ph.rngMu.Lock()
+	defer ph.rngMu.Unlock()
+	hit := roll.RollAll(ph.rng, fx.apply(cs.AttackBonus(w), adv))
+	onlyD20Crits(&hit)
+	hit.Label = fx.label(fmt.Sprintf("%s attacks with %s", cs.PlayerName, w.Name))
+	if hit.Results[0].IsCrit {
+		for _, r := range reqs {
+			r.Multiplier *= 2
+		}
+	}
+	dmg := roll.RollAll(ph.rng, reqs)
+	// Damage dice can't crit, whatever they roll.
+	for _, r := range dmg.Results {
+		r.IsCrit, r.IsCritFail = false, false
+	}
+	dmg.Label = strings.ToLower(strings.Join(types, " + "))
+	hit.Damage = &dmg
+	return &baepi.Baesponse{
+		Message:         hit.String(),
+		MentionUser:     true,
+		HandlerMetadata: hit,
+	}, nil
+}
@@ -0,0 +1,38 @@
+package player
+
+import (
+	"math/rand"
+	"testing"
+
+	"dicebae/roll"
+)
+
+func TestDamageRequests(t *testing.T) {
+	for _, tc := range []struct {
+		dice string
+		want string
+	}{
+		{"1", "**5**"},
+		{" 3 ", "**7**"},
+	} {
+		reqs, err := damageRequests(tc.dice)
+		if err != nil {
+			t.Errorf("damageRequests(%q) = %v", tc.dice, err)
+			continue
+		}
+		reqs[0].Modifier += 4
+		// Crits double dice, and flat damage has none to double.
+		reqs[0].Multiplier *= 2
+		if got := roll.RollAll(rand.New(rand.NewSource(1)), reqs); got.String() != tc.want {
+			t.Errorf("damage %q rolled %q, want %q", tc.dice, got.String(), tc.want)
+		}
+	}
+	if reqs, err := damageRequests("2d6"); err != nil || len(reqs) != 1 || reqs[0].Die != 6 {
+		t.Errorf("damageRequests(\"2d6\") = %v, %v, want 2d6", reqs, err)
+	}
+	for _, dice := range []string{"", "lots"} {
+		if _, err := damageRequests(dice); err == nil {
+			t.Errorf("damageRequests(%q) = nil, want an error", dice)
+		}
+	}
+}
@@ -0,0 +1,291 @@
+package player
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"dicebae/baepi"
+	"dicebae/roll"
+)
+
+const (
+	exhaustion = "exhaustion"
+	// maxExhaustion is the exhaustion level that kills.
+	maxExhaustion = 6
+)
+
+// conditions holds every condition the bae tracks, with other things people
+// call them.
+var conditions = map[string]string{
+	"blessed":       "blessed",
+	"bless":         "blessed",
+	"blinded":       "blinded",
+	"blind":         "blinded",
+	"charmed":       "charmed",
+	"deafened":      "deafened",
+	"deaf":          "deafened",
+	"exhaustion":    exhaustion,
+	"exhausted":     exhaustion,
+	"frightened":    "frightened",
+	"scared":        "frightened",
+	"grappled":      "grappled",
+	"incapacitated": "incapacitated",
+	"invisible":     "invisible",
+	"paralyzed":     "paralyzed",
+	"petrified":     "petrified",
+	"poisoned":      "poisoned",
+	"prone":         "prone",
+	"restrained":    "restrained",
+	"stunned":       "stunned",
+	"unconscious":   "unconscious",
+}
+
+// rollKind is the kind of d20 roll conditions might affect.
+type rollKind int
+
+const (
+	attackRoll rollKind = iota
+	checkRoll
+	saveRoll
+)
+
+// rollEffects are what a character's conditions do to one of their rolls.
+type rollEffects struct {
+	advantage    bool
+	disadvantage bool
+	bless        bool
+	// autoFail names the condition that makes the roll fail outright, if any.
+	autoFail string
+	// reasons names the conditions that changed the roll.
+	reasons []string
+}
+
+// effects works out what a character's conditions do to a roll. ability is
+// the ability a save is for, if any.
+func effects(conds map[string]int, kind rollKind, ability string) rollEffects {
+	var fx rollEffects
+	has := func(c string) bool { return conds[c] > 0 }
+	dis := func(c string) {
+		fx.disadvantage = true
+		fx.reasons = append(fx.reasons, c)
+	}
+	switch kind {
+	case attackRoll:
+		for _, c := range []string{"blinded", "frightened", "poisoned", "prone", "restrained"} {
+			if has(c) {
+				dis(c)
+			}
+		}
+		if conds[exhaustion] >= 3 {
+			dis(exhaustion)
+		}
+		if has("invisible") {
+			fx.advantage = true
+			fx.reasons = append(fx.reasons, "invisible")
+		}
+	case checkRoll:
+		for _, c := range []string{"frightened", "poisoned"} {
+			if has(c) {
+				dis(c)
+			}
+		}
+		if has(exhaustion) {
+			dis(exhaustion)
+		}
+	case saveRoll:
+		if ability == "str" || ability == "dex" {
+			for _, c := range []string{"paralyzed", "petrified", "stunned", "unconscious"} {
+				if has(c) {
+					fx.autoFail = c
+					return fx
+				}
+			}
+		}
+		if ability == "dex" && has("restrained") {
+			dis("restrained")
+		}
+		if conds[exhaustion] >= 3 {
+			dis(exhaustion)
+		}
+	}
+	if has("blessed") && kind != checkRoll {
+		fx.bless = true
+		fx.reasons = append(fx.reasons, "blessed")
+	}
+	return fx
+}
+
+// apply returns the roll requests for a d20 roll with the given modifier and
+// the effects, with the advantage someone asked for.
+func (fx rollEffects) apply(mod int, adv roll.Advantage) []*roll.RollRequest {
+	req := &roll.RollRequest{Multiplier: 1, Die: 20, Modifier: mod, Advantage: fx.withAdvantage(adv)}
+	return append([]*roll.RollRequest{req}, fx.extraDice()...)
+}
+
+// withAdvantage combines the effects with the advantage someone asked for,
+// which cancel out like any other sources of advantage and disadvantage.
+func (fx rollEffects) withAdvantage(adv roll.Advantage) roll.Advantage {
+	hasAdv := fx.advantage || adv == roll.WithAdvantage
+	hasDis := fx.disadvantage || adv == roll.WithDisadvantage
+	switch {
+	case hasAdv && !hasDis:
+		return roll.WithAdvantage
+	case hasDis && !hasAdv:
+		return roll.WithDisadvantage
+	}
+	return roll.NoAdvantage
+}
+
+// extraDice returns the dice the effects add to a roll, like bless's d4.
+func (fx rollEffects) extraDice() []*roll.RollRequest {
+	if fx.bless {
+		return []*roll.RollRequest{{Multiplier: 1, Die: 4}}
+	}
+	return nil
+}
+
+// onlyD20Crits clears crits from everything but a roll's d20, like bless's
+// d4.
+func onlyD20Crits(resp *roll.RollResponse) {
+	for _, r := range resp.Results[1:] {
+		r.IsCrit, r.IsCritFail = false, false
+	}
+}
+
+// label notes the conditions that changed a roll on its label.
+func (fx rollEffects) label(label string) string {
+	if len(fx.reasons) == 0 {
+		return label
+	}
+	return fmt.Sprintf("%s (%s)", label, strings.Join(fx.reasons, ", "))
+}
+
+// effectsOn works out what a character's conditions do to a roll.
+func (ph *PlayerHandler) effectsOn(key string, kind rollKind, ability string) rollEffects {
+	return effects(ph.overlays.get(key).Conditions, kind, ability)
+}
+
+// rollKinds maps the kinds of !roll rolls to the kinds conditions affect.
+var rollKinds = map[roll.RollKind]rollKind{
+	roll.CheckRoll:  checkRoll,
+	roll.SaveRoll:   saveRoll,
+	roll.AttackRoll: attackRoll,
+}
+
+// RollEffects implements roll.EffectResolver, so a !roll using the speaker's
+// variables, like "!roll d20+@dex.save", gets their conditions too.
+func (ph *PlayerHandler) RollEffects(e *baepi.Baevent, kind roll.RollKind, vars []string) (roll.Advantage, []*roll.RollRequest, string) {
+	key, cs := ph.boundSheet(e.GuildID, e.Speaker)
+	if cs == nil {
+		return roll.NoAdvantage, nil, ""
+	}
+	fx := ph.effectsOn(key, rollKinds[kind], variableAbility(vars))
+	if fx.autoFail != "" {
+		return roll.NoAdvantage, nil, fmt.Sprintf("%s, so it fails anyway", fx.autoFail)
+	}
+	return fx.withAdvantage(roll.NoAdvantage), fx.extraDice(), strings.Join(fx.reasons, ", ")
+}
+
+// variableAbility returns the ability rolled with the first variable that has
+// one, like "dex" for @dex.save, @stealth or @init.
+func variableAbility(vars []string) string {
+	for _, v := range vars {
+		base := strings.SplitN(v, ".", 2)[0]
+		if ab := abilityKey(base); ab != "" {
+			return ab
+		}
+		if ab, ok := skillAbilities[base]; ok {
+			return ab
+		}
+		if base == "init" {
+			return "dex"
+		}
+	}
+	return ""
+}
+
+// fmtConditions lists conditions, with exhaustion's level.
+func fmtConditions(conds map[string]int) string {
+	var ss []string
+	for c, n := range conds {
+		if c == exhaustion {
+			c = fmt.Sprintf("exhaustion %d", n)
+		}
+		ss = append(ss, c)
+	}
+	sort.Strings(ss)
+	return strings.Join(ss, ", ")
+}
+
+// ConditionHandler returns a handler for "!condition [character]
+// [+condition|-condition|clear]...", e.g., "!condition kira +poisoned -prone".
+// Each +exhaustion or -exhaustion changes its level by one.
+//
+// Conditions change !check, !save, !attack and !deathsave rolls, and !roll
+// when it uses the character's @ variables. Exhaustion also slows the
+// character and cuts their max HP.
+func (ph *PlayerHandler) ConditionHandler() baepi.BaeSayHandler {
+	return &command{hotword: "condition", say: ph.condition}
+}
+
+func (ph *PlayerHandler) condition(db baepi.DiceBae, e *baepi.Baevent, args []string) (*baepi.Baesponse, error) {
+	key, cs, args, missing := ph.whose(e, args)
+	if missing != nil {
+		return missing, nil
+	}
+	for _, a := range args {
+		if strings.ToLower(a) == "clear" {
+			continue
+		}
+		if len(a) < 2 || (a[0] != '+' && a[0] != '-') {
+			return say("Try !condition [character] +poisoned -prone, or clear."), nil
+		}
+		if _, ok := conditions[strings.ToLower(a[1:])]; !ok {
+			return say(fmt.Sprintf("%q isn't a condition I know.", a[1:])), nil
+		}
+	}
+	var msg string
+	err := ph.overlays.update(key, func(o *overlay) error {
+		var drama string
+		for _, a := range args {
+			if strings.ToLower(a) == "clear" {
+				o.Conditions = make(map[string]int)
+				continue
+			}
+			c := conditions[strings.ToLower(a[1:])]
+			switch {
+			case a[0] == '-' && c == exhaustion && o.Conditions[c] > 1:
+				o.Conditions[c]--
+			case a[0] == '-':
+				delete(o.Conditions, c)
+			case c == exhaustion:
+				if o.Conditions[c] < maxExhaustion {
+					o.Conditions[c]++
+				}
+				if o.Conditions[c] == maxExhaustion && !o.dead() {
+					o.hp(cs)
+					o.setHP(0)
+					o.DeathSaves = deathSaves{Failures: 3}
+					drama = fmt.Sprintf(" **%s is dead.** Exhaustion got them.", cs.PlayerName)
+				}
+			default:
+				o.Conditions[c] = 1
+			}
+		}
+		if max := o.maxHP(cs); o.Conditions[exhaustion] >= 4 && o.hp(cs) > max {
+			o.setHP(max)
+		}
+		if len(o.Conditions) == 0 {
+			msg = fmt.Sprintf("%s has no conditions. Probably fine.", cs.PlayerName)
+		} else {
+			msg = fmt.Sprintf("**%s's conditions:** %s", cs.PlayerName, fmtConditions(o.Conditions))
+		}
+		msg += drama
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return say(msg), nil
+}
@@ -0,0 +1,80 @@
+package player
+
+import (
+	"reflect"
+	"testing"
+
+	"dicebae/roll"
+)
+
+func TestEffects(t *testing.T) {
+	for _, tc := range []struct {
+		desc     string
+		conds    map[string]int
+		kind     rollKind
+		ability  string
+		adv      roll.Advantage
+		want     []roll.RollRequest
+		autoFail string
+	}{
+		{"nothing", nil, attackRoll, "", roll.NoAdvantage,
+			[]roll.RollRequest{{Multiplier: 1, Die: 20, Modifier: 5}}, ""},
+		{"poisoned attack", map[string]int{"poisoned": 1}, attackRoll, "", roll.NoAdvantage,
+			[]roll.RollRequest{{Multiplier: 1, Die: 20, Modifier: 5, Advantage: roll.WithDisadvantage}}, ""},
+		{"poisoned attack with advantage", map[string]int{"poisoned": 1}, attackRoll, "", roll.WithAdvantage,
+			[]roll.RollRequest{{Multiplier: 1, Die: 20, Modifier: 5}}, ""},
+		{"invisible and prone", map[string]int{"invisible": 1, "prone": 1}, attackRoll, "", roll.NoAdvantage,
+			[]roll.RollRequest{{Multiplier: 1, Die: 20, Modifier: 5}}, ""},
+		{"invisible attack", map[string]int{"invisible": 1}, attackRoll, "", roll.NoAdvantage,
+			[]roll.RollRequest{{Multiplier: 1, Die: 20, Modifier: 5, Advantage: roll.WithAdvantage}}, ""},
+		{"blessed attack", map[string]int{"blessed": 1}, attackRoll, "", roll.NoAdvantage,
+			[]roll.RollRequest{{Multiplier: 1, Die: 20, Modifier: 5}, {Multiplier: 1, Die: 4}}, ""},
+		{"blessed check", map[string]int{"blessed": 1}, checkRoll, "", roll.NoAdvantage,
+			[]roll.RollRequest{{Multiplier: 1, Die: 20, Modifier: 5}}, ""},
+		{"exhausted check", map[string]int{exhaustion: 1}, checkRoll, "", roll.NoAdvantage,
+			[]roll.RollRequest{{Multiplier: 1, Die: 20, Modifier: 5, Advantage: roll.WithDisadvantage}}, ""},
+		{"slightly exhausted save", map[string]int{exhaustion: 2}, saveRoll, "con", roll.NoAdvantage,
+			[]roll.RollRequest{{Multiplier: 1, Die: 20, Modifier: 5}}, ""},
+		{"very exhausted save", map[string]int{exhaustion: 3}, saveRoll, "con", roll.NoAdvantage,
+			[]roll.RollRequest{{Multiplier: 1, Die: 20, Modifier: 5, Advantage: roll.WithDisadvantage}}, ""},
+		{"restrained dex save", map[string]int{"restrained": 1}, saveRoll, "dex", roll.NoAdvantage,
+			[]roll.RollRequest{{Multiplier: 1, Die: 20, Modifier: 5, Advantage: roll.WithDisadvantage}}, ""},
+		{"restrained wis save", map[string]int{"restrained": 1}, saveRoll, "wis", roll.NoAdvantage,
+			[]roll.RollRequest{{Multiplier: 1, Die: 20, Modifier: 5}}, ""},
+		{"stunned str save", map[string]int{"stunned": 1}, saveRoll, "str", roll.NoAdvantage, nil, "stunned"},
+		{"stunned con save", map[string]int{"stunned": 1}, saveRoll, "con", roll.NoAdvantage,
+			[]roll.RollRequest{{Multiplier: 1, Die: 20, Modifier: 5}}, ""},
+	} {
+		fx := effects(tc.conds, tc.kind, tc.ability)
+		if fx.autoFail != tc.autoFail {
+			t.Errorf("%s: got autoFail %q, want %q", tc.desc, fx.autoFail, tc.autoFail)
+		}
+		if tc.autoFail != "" {
+			continue
+		}
+		var got []roll.RollRequest
+		for _, r := range fx.apply(5, tc.adv) {
+			got = append(got, *r)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: apply() = %+v, want %+v", tc.desc, got, tc.want)
+		}
+	}
+}
+
+func TestVariableAbility(t *testing.T) {
+	for _, tc := range []struct {
+		vars []string
+		want string
+	}{
+		{[]string{"dex.save"}, "dex"},
+		{[]string{"stealth"}, "dex"},
+		{[]string{"init"}, "dex"},
+		{[]string{"prof", "wis"}, "wis"},
+		{[]string{"prof"}, ""},
+	} {
+		if got := variableAbility(tc.vars); got != tc.want {
+			t.Errorf("variableAbility(%q) = %q, want %q", tc.vars, got, tc.want)
+		}
+	}
+}
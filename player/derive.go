@@ -0,0 +1,232 @@
+package player
+
+import (
+	"strings"
+)
+
+// Armor type IDs in D&D Beyond item definitions.
+const (
+	lightArmor  = 1
+	mediumArmor = 2
+	heavyArmor  = 3
+	shield      = 4
+)
+
+// statAbilities maps D&D Beyond stat IDs to abilities.
+var statAbilities = []string{"", "str", "dex", "con", "int", "wis", "cha"}
+
+// statAbility returns the ability with a D&D Beyond stat ID, or "" if there's
+// no such stat.
+func statAbility(id int) string {
+	if id > 0 && id < len(statAbilities) {
+		return statAbilities[id]
+	}
+	return ""
+}
+
+// scoreAbility returns the ability of a modifier subtype like
+// "strength-score", or "" if it isn't one.
+func scoreAbility(subType string) string {
+	if !strings.HasSuffix(subType, "-score") {
+		return ""
+	}
+	return abilityKey(strings.TrimSuffix(subType, "-score"))
+}
+
+// score returns a pointer to one of the character's ability scores.
+func (cs *CharacterSheet) score(ability string) *int {
+	switch ability {
+	case "str":
+		return &cs.Str
+	case "dex":
+		return &cs.Dex
+	case "con":
+		return &cs.Con
+	case "int":
+		return &cs.Int
+	case "wis":
+		return &cs.Wis
+	case "cha":
+		return &cs.Cha
+	}
+	return nil
+}
+
+// derive works out everything about the character that comes from their
+// scores and modifiers rather than straight off the sheet. Scores go first,
+// since everything else depends on them.
+func (cs *CharacterSheet) derive(p *DNDBeyondJSON, mods []Modifier) {
+	cs.setAbilityScores(p, mods)
+	armored := cs.setArmorClass(p, mods)
+	cs.setSpeed(p, mods, armored)
+	cs.setHitPoints(p, mods)
+	for _, m := range mods {
+		if m.Type != "bonus" {
+			continue
+		}
+		switch m.SubType {
+		case "initiative":
+			cs.InitiativeBonus += m.Value
+		case "spell-save-dc":
+			cs.SpellSaveDCBonus += m.Value
+		case "passive-perception", "passive-insight", "passive-investigation":
+			if cs.PassiveBonuses == nil {
+				cs.PassiveBonuses = make(map[string]int)
+			}
+			cs.PassiveBonuses[strings.TrimPrefix(m.SubType, "passive-")] += m.Value
+		}
+	}
+}
+
+// setAbilityScores applies bonuses from every source and the sheet's own
+// bonus stats, then items that set a score, like Gauntlets of Ogre Power,
+// and finally any scores overridden on the sheet.
+func (cs *CharacterSheet) setAbilityScores(p *DNDBeyondJSON, mods []Modifier) {
+	for _, s := range p.BonusStats {
+		if s.Value != nil && s.ID > 0 && s.ID < len(statAbilities) {
+			*cs.score(statAbilities[s.ID]) += *s.Value
+		}
+	}
+	for _, m := range mods {
+		if sc := cs.score(scoreAbility(m.SubType)); sc != nil && m.Type == "bonus" {
+			*sc += m.Value
+		}
+	}
+	for _, m := range mods {
+		if sc := cs.score(scoreAbility(m.SubType)); sc != nil && m.Type == "set" && m.Value > *sc {
+			*sc = m.Value
+		}
+	}
+	for _, s := range p.OverrideStats {
+		if s.Value != nil && s.ID > 0 && s.ID < len(statAbilities) {
+			*cs.score(statAbilities[s.ID]) = *s.Value
+		}
+	}
+}
+
+// setArmorClass works out the character's AC from their equipped armor and
+// shield, or their best unarmored defense, and returns whether they're
+// wearing armor.
+func (cs *CharacterSheet) setArmorClass(p *DNDBeyondJSON, mods []Modifier) bool {
+	var armor *ItemDefinition
+	shieldAC := 0
+	for i := range p.Inventory {
+		it := &p.Inventory[i]
+		if !it.Equipped {
+			continue
+		}
+		switch it.Definition.ArmorTypeID {
+		case lightArmor, mediumArmor, heavyArmor:
+			if armor == nil || it.Definition.ArmorClass > armor.ArmorClass {
+				armor = &it.Definition
+			}
+		case shield:
+			if it.Definition.ArmorClass > shieldAC {
+				shieldAC = it.Definition.ArmorClass
+			}
+		}
+	}
+
+	dex := cs.Mod("dex")
+	var ac int
+	switch {
+	case armor == nil:
+		ac = 10 + dex
+		for _, m := range mods {
+			if m.Type != "set" || m.SubType != "unarmored-armor-class" {
+				continue
+			}
+			// e.g., a Barbarian's adds Con, and Draconic Resilience adds 3.
+			uac := 10 + dex + m.Value
+			if m.StatID > 0 && m.StatID < len(statAbilities) {
+				uac += cs.Mod(statAbilities[m.StatID])
+			}
+			if uac > ac {
+				ac = uac
+			}
+		}
+	case armor.ArmorTypeID == lightArmor:
+		ac = armor.ArmorClass + dex
+	case armor.ArmorTypeID == mediumArmor:
+		if dex > 2 {
+			dex = 2
+		}
+		ac = armor.ArmorClass + dex
+	default:
+		ac = armor.ArmorClass
+	}
+	ac += shieldAC
+
+	for _, m := range mods {
+		if m.Type != "bonus" {
+			continue
+		}
+		switch {
+		case m.SubType == "armor-class":
+			ac += m.Value
+		case m.SubType == "armored-armor-class" && armor != nil:
+			ac += m.Value
+		case m.SubType == "unarmored-armor-class" && armor == nil:
+			ac += m.Value
+		}
+	}
+	cs.AC = ac
+	return armor != nil || shieldAC > 0
+}
+
+// setSpeed works out the character's walking speed from their race, plus
+// bonuses, including a Monk's unarmored movement.
+func (cs *CharacterSheet) setSpeed(p *DNDBeyondJSON, mods []Modifier, armored bool) {
+	if p.Race != nil {
+		cs.Speed = p.Race.WeightSpeeds.Normal.Walk
+	}
+	for _, m := range mods {
+		if m.Type == "set" && m.SubType == "innate-speed-walking" && m.Value > cs.Speed {
+			cs.Speed = m.Value
+		}
+	}
+	for _, m := range mods {
+		if m.Type != "bonus" {
+			continue
+		}
+		switch {
+		case m.SubType == "speed", m.SubType == "speed-walking":
+			cs.Speed += m.Value
+		case m.SubType == "unarmored-movement" && !armored:
+			cs.Speed += m.Value
+		}
+	}
+}
+
+// setHitPoints works out the character's max HP from their rolled or fixed
+// hit points, Constitution and per-level bonuses like Tough, unless the sheet
+// overrides it.
+func (cs *CharacterSheet) setHitPoints(p *DNDBeyondJSON, mods []Modifier) {
+	hp := p.BaseHitPoints + statMod(cs.Con)*cs.Level
+	for _, m := range mods {
+		if m.Type == "bonus" && m.SubType == "hit-points-per-level" {
+			hp += m.Value * cs.Level
+		}
+	}
+	if p.BonusHitPoints != nil {
+		hp += *p.BonusHitPoints
+	}
+	if p.OverrideHitPoints != nil {
+		hp = *p.OverrideHitPoints
+	}
+	cs.TotalHP = hp
+	cs.CurrentHP = hp - p.RemovedHitPoints
+	cs.TempHP = p.TemporaryHitPoints
+}
+
+// Initiative returns the character's initiative bonus, which is a Dexterity
+// check plus anything like the Alert feat.
+func (cs *CharacterSheet) Initiative() int {
+	return cs.AbilityCheckBonus("dex") + cs.InitiativeBonus
+}
+
+// Passive returns the character's passive score for a skill, e.g.,
+// "perception".
+func (cs *CharacterSheet) Passive(skill string) int {
+	return 10 + cs.SkillBonus(skill) + cs.PassiveBonuses[skill]
+}
@@ -0,0 +1,165 @@
+package player
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"dicebae/baepi"
+)
+
+// Feature is a limited-use feature, like Action Surge or Bardic Inspiration.
+type Feature struct {
+	Name    string
+	MaxUses int
+	// ShortRest is whether the feature comes back on a short rest, rather
+	// than only a long one.
+	ShortRest bool
+}
+
+// boringFeatures are class features every class has, which aren't news.
+var boringFeatures = map[string]bool{
+	"hit points":    true,
+	"proficiencies": true,
+	"equipment":     true,
+}
+
+// setFeatures collects the names of all the character's features, and the
+// limited-use ones in detail. It needs their scores and proficiency bonus,
+// since some features' uses depend on them.
+func (cs *CharacterSheet) setFeatures(p *DNDBeyondJSON) {
+	var defs []FeatureDefinition
+	if p.Race != nil {
+		for _, t := range p.Race.RacialTraits {
+			defs = append(defs, t.Definition)
+		}
+	}
+	for _, c := range p.Classes {
+		for _, f := range c.ClassFeatures {
+			// Sheets list the features of every level, not just those the
+			// character has reached.
+			if f.Definition.RequiredLevel <= c.Level {
+				defs = append(defs, f.Definition)
+			}
+		}
+	}
+	for _, f := range p.Feats {
+		defs = append(defs, f.Definition)
+	}
+	named := make(map[string]bool)
+	for _, d := range defs {
+		if n := strings.ToLower(d.Name); n != "" && !named[n] && !boringFeatures[n] {
+			named[n] = true
+			cs.FeatureNames = append(cs.FeatureNames, d.Name)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, as := range [][]Action{p.Actions.Race, p.Actions.Class, p.Actions.Feat, p.Actions.Item} {
+		for _, a := range as {
+			lu := a.LimitedUse
+			if lu == nil || a.Name == "" || seen[strings.ToLower(a.Name)] {
+				continue
+			}
+			uses := lu.MaxUses
+			switch {
+			case lu.UseProficiencyBonus:
+				uses = cs.ProficiencyBonus()
+			case lu.StatModifierUsesID > 0:
+				uses = cs.Mod(statAbility(lu.StatModifierUsesID))
+				if uses < 1 {
+					uses = 1
+				}
+			}
+			if uses < 1 {
+				continue
+			}
+			seen[strings.ToLower(a.Name)] = true
+			cs.Features = append(cs.Features, &Feature{
+				Name:      a.Name,
+				MaxUses:   uses,
+				ShortRest: lu.ResetType == resetShortRest,
+			})
+		}
+	}
+	sort.Slice(cs.Features, func(i, j int) bool { return cs.Features[i].Name < cs.Features[j].Name })
+}
+
+// findFeature returns the character's feature best matching name.
+func (cs *CharacterSheet) findFeature(name string) (*Feature, error) {
+	name = strings.ToLower(name)
+	var found []*Feature
+	for _, f := range cs.Features {
+		n := strings.ToLower(f.Name)
+		if n == name {
+			return f, nil
+		}
+		if strings.HasPrefix(n, name) {
+			found = append(found, f)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("%s doesn't have %s", cs.PlayerName, name)
+	case 1:
+		return found[0], nil
+	}
+	var names []string
+	for _, f := range found {
+		names = append(names, f.Name)
+	}
+	return nil, fmt.Errorf("%q could be %s", name, strings.Join(names, " or "))
+}
+
+// fmtFeatures formats the uses the character has left of each feature.
+func (cs *CharacterSheet) fmtFeatures(o overlay) string {
+	if len(cs.Features) == 0 {
+		return fmt.Sprintf("%s has no limited-use features.", cs.PlayerName)
+	}
+	var ss []string
+	for _, f := range cs.Features {
+		ss = append(ss, fmt.Sprintf("%s %d/%d", f.Name, f.MaxUses-o.FeaturesUsed[strings.ToLower(f.Name)], f.MaxUses))
+	}
+	return fmt.Sprintf("**%s's features:** %s", cs.PlayerName, strings.Join(ss, ", "))
+}
+
+// UseHandler returns a handler for "!use [character] [feature]", spending a
+// use of a limited-use feature, or listing what's left without one.
+func (ph *PlayerHandler) UseHandler() baepi.BaeSayHandler {
+	return &command{hotword: "use", say: ph.use}
+}
+
+func (ph *PlayerHandler) use(db baepi.DiceBae, e *baepi.Baevent, args []string) (*baepi.Baesponse, error) {
+	key, cs, args, missing := ph.whose(e, args)
+	if missing != nil {
+		return missing, nil
+	}
+	if len(args) == 0 {
+		return say(cs.fmtFeatures(ph.overlays.get(key))), nil
+	}
+	f, err := cs.findFeature(strings.Join(args, " "))
+	if err != nil {
+		return say(err.Error() + "."), nil
+	}
+	var msg string
+	err = ph.overlays.update(key, func(o *overlay) error {
+		n := strings.ToLower(f.Name)
+		if o.FeaturesUsed[n] >= f.MaxUses {
+			return fmt.Errorf("%s is out of %s until a %s rest", cs.PlayerName, f.Name, restName(f.ShortRest))
+		}
+		o.FeaturesUsed[n]++
+		msg = fmt.Sprintf("%s uses %s (%d/%d left).", cs.PlayerName, f.Name, f.MaxUses-o.FeaturesUsed[n], f.MaxUses)
+		return nil
+	})
+	if err != nil {
+		return say(err.Error() + "."), nil
+	}
+	return say(msg), nil
+}
+
+func restName(short bool) string {
+	if short {
+		return "short"
+	}
+	return "long"
+}
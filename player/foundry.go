@@ -0,0 +1,261 @@
+package player
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// foundryActor is the subset of a Foundry VTT dnd5e actor export the bae
+// understands. Newer Foundry versions keep actor data under "system", older
+// ones under "data".
+type foundryActor struct {
+	Name   string              `json:"name"`
+	Type   string              `json:"type"`
+	System *foundryActorSystem `json:"system"`
+	Data   *foundryActorSystem `json:"data"`
+	Items  []foundryItem       `json:"items"`
+}
+
+type foundryActorSystem struct {
+	Abilities map[string]struct {
+		Value      int     `json:"value"`
+		Proficient float64 `json:"proficient"`
+	} `json:"abilities"`
+	Attributes struct {
+		HP struct {
+			Value int `json:"value"`
+			Max   int `json:"max"`
+		} `json:"hp"`
+		// AC is only exported if it's a flat value rather than calculated.
+		AC struct {
+			Flat  *int `json:"flat"`
+			Value int  `json:"value"`
+		} `json:"ac"`
+		Movement struct {
+			Walk float64 `json:"walk"`
+		} `json:"movement"`
+		// Spellcasting is the actor's spellcasting ability, e.g., "int".
+		Spellcasting string `json:"spellcasting"`
+	} `json:"attributes"`
+	Skills map[string]struct {
+		Value float64 `json:"value"`
+	} `json:"skills"`
+	Details struct {
+		Level json.Number `json:"level"`
+		CR    json.Number `json:"cr"`
+	} `json:"details"`
+	// Traits holds damage resistances, immunities and vulnerabilities.
+	Traits struct {
+		DR foundryTrait `json:"dr"`
+		DI foundryTrait `json:"di"`
+		DV foundryTrait `json:"dv"`
+	} `json:"traits"`
+}
+
+type foundryTrait struct {
+	Value []string `json:"value"`
+}
+
+type foundryItem struct {
+	Name   string             `json:"name"`
+	Type   string             `json:"type"`
+	System *foundryItemSystem `json:"system"`
+	Data   *foundryItemSystem `json:"data"`
+}
+
+type foundryItemSystem struct {
+	// Levels, HitDice and Subclass are only set for classes. Newer versions of
+	// Foundry keep subclasses as items of their own, which the bae ignores.
+	Levels   int    `json:"levels"`
+	HitDice  string `json:"hitDice"`
+	Subclass string `json:"subclass"`
+	// The rest is only set for weapons.
+	ActionType string `json:"actionType"`
+	Damage     struct {
+		Parts     [][]string `json:"parts"`
+		Versatile string     `json:"versatile"`
+	} `json:"damage"`
+	// Properties is a set of property abbreviations, which older versions of
+	// Foundry export as an object and newer ones as a list.
+	Properties json.RawMessage `json:"properties"`
+	Proficient interface{}     `json:"proficient"`
+	Equipped   bool            `json:"equipped"`
+}
+
+// hasProperty returns whether a Foundry weapon has a property, e.g., "fin".
+func (is *foundryItemSystem) hasProperty(p string) bool {
+	var list []string
+	if err := json.Unmarshal(is.Properties, &list); err == nil {
+		for _, l := range list {
+			if l == p {
+				return true
+			}
+		}
+		return false
+	}
+	var set map[string]bool
+	json.Unmarshal(is.Properties, &set)
+	return set[p]
+}
+
+// foundryDice strips Foundry's roll data references from a damage formula,
+// e.g., "1d8 + @mod" becomes "1d8".
+func foundryDice(formula string) string {
+	return strings.TrimSpace(strings.Split(formula, "+ @")[0])
+}
+
+// foundrySkills maps Foundry's skill abbreviations to D&D Beyond's names.
+var foundrySkills = map[string]string{
+	"acr": "acrobatics",
+	"ani": "animal-handling",
+	"arc": "arcana",
+	"ath": "athletics",
+	"dec": "deception",
+	"his": "history",
+	"ins": "insight",
+	"itm": "intimidation",
+	"inv": "investigation",
+	"med": "medicine",
+	"nat": "nature",
+	"prc": "perception",
+	"prf": "performance",
+	"per": "persuasion",
+	"rel": "religion",
+	"slt": "sleight-of-hand",
+	"ste": "stealth",
+	"sur": "survival",
+}
+
+// foundrySource loads a character from a Foundry VTT actor export.
+type foundrySource struct {
+	path string
+}
+
+func (s *foundrySource) Key() string {
+	return "foundry:" + s.path
+}
+
+func (s *foundrySource) Load(force bool) (*CharacterSheet, error) {
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read foundry actor: %v", err)
+	}
+	fa := &foundryActor{}
+	if err := json.Unmarshal(b, fa); err != nil {
+		return nil, fmt.Errorf("failed to parse foundry actor %q: %v", s.path, err)
+	}
+	sys := fa.System
+	if sys == nil {
+		sys = fa.Data
+	}
+	if fa.Name == "" || sys == nil {
+		return nil, fmt.Errorf("%q doesn't look like a foundry actor export", s.path)
+	}
+	return fa.characterSheet(sys), nil
+}
+
+func (s *foundrySource) Cached() (*CharacterSheet, time.Time) {
+	return nil, time.Time{}
+}
+
+func (fa *foundryActor) characterSheet(sys *foundryActorSystem) *CharacterSheet {
+	cs := &CharacterSheet{
+		PlayerName: fa.Name,
+		CurrentHP:  sys.Attributes.HP.Value,
+		TotalHP:    sys.Attributes.HP.Max,
+		AC:         sys.Attributes.AC.Value,
+		Speed:      int(sys.Attributes.Movement.Walk),
+		Str:        sys.Abilities["str"].Value,
+		Dex:        sys.Abilities["dex"].Value,
+		Con:        sys.Abilities["con"].Value,
+		Int:        sys.Abilities["int"].Value,
+		Wis:        sys.Abilities["wis"].Value,
+		Cha:        sys.Abilities["cha"].Value,
+	}
+	if f := sys.Attributes.AC.Flat; f != nil {
+		cs.AC = *f
+	}
+	// Foundry stores proficiency as a multiplier of the proficiency bonus.
+	for ab, a := range sys.Abilities {
+		if a.Proficient >= 1 {
+			cs.addSaveProficiency(ab)
+		}
+	}
+	for _, t := range sys.Traits.DR.Value {
+		cs.addDefense("resistance", t)
+	}
+	for _, t := range sys.Traits.DI.Value {
+		cs.addDefense("immunity", t)
+	}
+	for _, t := range sys.Traits.DV.Value {
+		cs.addDefense("vulnerability", t)
+	}
+	for abbr, sk := range sys.Skills {
+		switch sk.Value {
+		case 0.5:
+			cs.addProficiency(foundrySkills[abbr], HalfProficient)
+		case 1:
+			cs.addProficiency(foundrySkills[abbr], Proficient)
+		case 2:
+			cs.addProficiency(foundrySkills[abbr], Expertise)
+		}
+	}
+	for _, it := range fa.Items {
+		is := it.System
+		if is == nil {
+			is = it.Data
+		}
+		if it.Type != "weapon" || is == nil || len(is.Damage.Parts) == 0 || len(is.Damage.Parts[0]) < 2 {
+			continue
+		}
+		w := &Weapon{
+			Name:       it.Name,
+			Damage:     foundryDice(is.Damage.Parts[0][0]),
+			DamageType: is.Damage.Parts[0][1],
+			Versatile:  foundryDice(is.Damage.Versatile),
+			Finesse:    is.hasProperty("fin"),
+			Ranged:     is.ActionType == "rwak",
+			// Foundry leaves proficiency unset when it should be worked out from
+			// the weapon type, which is most likely for weapons anyone uses.
+			Proficient: is.Proficient == nil || is.Proficient == true || is.Proficient == 1.0,
+		}
+		for _, part := range is.Damage.Parts[1:] {
+			if len(part) == 2 {
+				w.Extra = append(w.Extra, ExtraDamage{Dice: foundryDice(part[0]), Type: part[1]})
+			}
+		}
+		cs.Weapons = append(cs.Weapons, w)
+	}
+	// Character levels come from their class items.
+	for _, it := range fa.Items {
+		is := it.System
+		if is == nil {
+			is = it.Data
+		}
+		if it.Type != "class" || is == nil {
+			continue
+		}
+		hd, _ := strconv.Atoi(strings.TrimPrefix(is.HitDice, "d"))
+		cs.addClass(ClassLevel{
+			Name:     it.Name,
+			Subclass: is.Subclass,
+			Level:    is.Levels,
+			HitDie:   hd,
+			// Foundry only records one spellcasting ability for the whole actor.
+			SpellAbility: abilityKey(sys.Attributes.Spellcasting),
+		})
+	}
+	if cs.Level == 0 {
+		if lvl, err := sys.Details.Level.Int64(); err == nil {
+			cs.Level = int(lvl)
+		}
+	}
+	if len(cs.Classes) == 0 && fa.Type == "npc" {
+		cs.Class = "NPC (CR " + sys.Details.CR.String() + ")"
+	}
+	return cs
+}
@@ -0,0 +1,372 @@
+package player
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"dicebae/baepi"
+	"dicebae/roll"
+)
+
+var (
+	damageTypeRegexp = regexp.MustCompile(`^[a-zA-Z]+$`)
+)
+
+// addDefense records a damage resistance, immunity or vulnerability.
+func (cs *CharacterSheet) addDefense(kind, damageType string) {
+	var m *map[string]bool
+	switch kind {
+	case "resistance":
+		m = &cs.Resistances
+	case "immunity":
+		m = &cs.Immunities
+	case "vulnerability":
+		m = &cs.Vulnerabilities
+	default:
+		return
+	}
+	if *m == nil {
+		*m = make(map[string]bool)
+	}
+	(*m)[strings.ToLower(damageType)] = true
+}
+
+// adjustDamage applies the character's defenses against a damage type,
+// returning the damage they actually take and why, if it changed.
+func (cs *CharacterSheet) adjustDamage(amount int, damageType string) (int, string) {
+	t := strings.ToLower(damageType)
+	switch {
+	case t == "":
+		return amount, ""
+	case cs.Immunities[t]:
+		return 0, "immune"
+	case cs.Resistances[t]:
+		return amount / 2, "resisted"
+	case cs.Vulnerabilities[t]:
+		return amount * 2, "vulnerable"
+	}
+	return amount, ""
+}
+
+// withOverlay returns a copy of the sheet with HP and conditions the bae has
+// been tracking, and what exhaustion does to their speed and max HP.
+func (cs *CharacterSheet) withOverlay(o overlay) *CharacterSheet {
+	c := *cs
+	if o.HP != nil {
+		c.CurrentHP = *o.HP
+		c.TempHP = o.TempHP
+	}
+	c.Conditions = o.Conditions
+	c.TotalHP = o.maxHP(cs)
+	if c.CurrentHP > c.TotalHP {
+		c.CurrentHP = c.TotalHP
+	}
+	switch ex := o.Conditions[exhaustion]; {
+	case ex >= 5:
+		c.Speed = 0
+	case ex >= 2:
+		c.Speed /= 2
+	}
+	return &c
+}
+
+// maxHP returns the character's max HP, which is halved from the fourth level
+// of exhaustion.
+func (o *overlay) maxHP(cs *CharacterSheet) int {
+	if o.Conditions[exhaustion] >= 4 {
+		return cs.TotalHP / 2
+	}
+	return cs.TotalHP
+}
+
+// hp returns the character's current HP, starting the overlay's HP tracking
+// from the sheet if it hasn't already.
+func (o *overlay) hp(cs *CharacterSheet) int {
+	if o.HP == nil {
+		o.setHP(cs.CurrentHP)
+		o.TempHP = cs.TempHP
+	}
+	return *o.HP
+}
+
+// setHP sets the overlay's HP.
+func (o *overlay) setHP(hp int) {
+	o.HP = &hp
+}
+
+func (o *overlay) dead() bool {
+	return o.DeathSaves.Failures >= 3
+}
+
+// takeDamage applies damage to temp HP, then HP, and describes anything
+// dramatic that happened.
+func (o *overlay) takeDamage(cs *CharacterSheet, amount int) string {
+	hp := o.hp(cs)
+	if o.dead() {
+		return fmt.Sprintf(" %s is already dead. Let them rest.", cs.PlayerName)
+	}
+	if o.TempHP > 0 {
+		absorbed := amount
+		if absorbed > o.TempHP {
+			absorbed = o.TempHP
+		}
+		o.TempHP -= absorbed
+		amount -= absorbed
+	}
+	if amount == 0 {
+		return ""
+	}
+	if hp == 0 {
+		o.DeathSaves.Stable = false
+		if amount >= o.maxHP(cs) {
+			o.DeathSaves.Failures = 3
+			return fmt.Sprintf(" **%s is dead.** That's massive damage.", cs.PlayerName)
+		}
+		o.DeathSaves.Failures++
+		if o.dead() {
+			return fmt.Sprintf(" **%s is dead.**", cs.PlayerName)
+		}
+		return fmt.Sprintf(" That's a failed death save for %s (%s).", cs.PlayerName, o.DeathSaves)
+	}
+	if amount < hp {
+		o.setHP(hp - amount)
+		return ""
+	}
+	o.setHP(0)
+	o.DeathSaves = deathSaves{}
+	if amount-hp >= o.maxHP(cs) {
+		o.DeathSaves.Failures = 3
+		return fmt.Sprintf(" **%s is dead.** That's massive damage.", cs.PlayerName)
+	}
+	return fmt.Sprintf(" **%s drops to 0 HP!**", cs.PlayerName)
+}
+
+// heal restores HP up to the character's max, picking them back up if they're
+// down.
+func (o *overlay) heal(cs *CharacterSheet, amount int) (string, error) {
+	hp := o.hp(cs)
+	if o.dead() {
+		return "", fmt.Errorf("%s is dead, that's going to take more than a heal", cs.PlayerName)
+	}
+	wasDown := hp == 0
+	hp += amount
+	if max := o.maxHP(cs); hp > max {
+		hp = max
+	}
+	o.setHP(hp)
+	if wasDown && hp > 0 {
+		o.DeathSaves = deathSaves{}
+		return fmt.Sprintf(" **%s is back up!**", cs.PlayerName), nil
+	}
+	return "", nil
+}
+
+func (ds deathSaves) String() string {
+	return fmt.Sprintf("%d succeeded, %d failed", ds.Successes, ds.Failures)
+}
+
+// rollAmount works out an amount of damage or healing that's either a plain
+// number or dice to roll, and describes the roll, if any.
+func (ph *PlayerHandler) rollAmount(expr string) (int, string, error) {
+	if n, err := strconv.Atoi(expr); err == nil {
+		if n < 0 {
+			return 0, "", fmt.Errorf("%d isn't a lot", n)
+		}
+		return n, "", nil
+	}
+	reqs, err := roll.ParseRollRequests(expr)
+	if err != nil || len(reqs) == 0 {
+		return 0, "", fmt.Errorf("%q isn't a number or dice", expr)
+	}
+	ph.rngMu.Lock()
+	resp := roll.RollAll(ph.rng, reqs)
+	ph.rngMu.Unlock()
+	for _, r := range resp.Results {
+		r.IsCrit, r.IsCritFail = false, false
+	}
+	if resp.Total < 0 {
+		resp.Total = 0
+	}
+	return resp.Total, " (" + resp.String() + ")", nil
+}
+
+// fmtHP describes a character's HP from the overlay.
+func fmtHP(cs *CharacterSheet, o *overlay) string {
+	s := fmt.Sprintf("%d/%d HP", *o.HP, o.maxHP(cs))
+	if o.TempHP > 0 {
+		s += fmt.Sprintf(" (+%d temp)", o.TempHP)
+	}
+	return s
+}
+
+// DamageHandler returns a handler for "!damage [character] <amount> [type]",
+// where the amount may be dice, e.g., "!damage kira 2d6 fire".
+func (ph *PlayerHandler) DamageHandler() baepi.BaeSayHandler {
+	return &command{hotword: "damage", say: ph.damage}
+}
+
+func (ph *PlayerHandler) damage(db baepi.DiceBae, e *baepi.Baevent, args []string) (*baepi.Baesponse, error) {
+	key, cs, args, missing := ph.whose(e, args)
+	if missing != nil {
+		return missing, nil
+	}
+	if len(args) < 1 {
+		return say("Try !damage [character] <amount> [type]."), nil
+	}
+	amountArgs, damageType := args, ""
+	if n := len(amountArgs); n > 1 && damageTypeRegexp.MatchString(amountArgs[n-1]) {
+		amountArgs, damageType = amountArgs[:n-1], strings.ToLower(amountArgs[n-1])
+	}
+	amount, rolled, err := ph.rollAmount(strings.Join(amountArgs, ""))
+	if err != nil {
+		return say(err.Error() + "."), nil
+	}
+	taken, why := cs.adjustDamage(amount, damageType)
+
+	msg := fmt.Sprintf("%s takes %d", cs.PlayerName, taken)
+	if damageType != "" {
+		msg += " " + damageType
+	}
+	msg += " damage" + rolled
+	if why != "" {
+		msg += fmt.Sprintf(", %s from %d", why, amount)
+	}
+	err = ph.overlays.update(key, func(o *overlay) error {
+		drama := o.takeDamage(cs, taken)
+		msg += fmt.Sprintf(", now at %s.%s", fmtHP(cs, o), drama)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return say(msg), nil
+}
+
+// HealHandler returns a handler for "!heal [character] <amount>", where the
+// amount may be dice, e.g., "!heal kira 2d4+2".
+func (ph *PlayerHandler) HealHandler() baepi.BaeSayHandler {
+	return &command{hotword: "heal", say: ph.heal}
+}
+
+func (ph *PlayerHandler) heal(db baepi.DiceBae, e *baepi.Baevent, args []string) (*baepi.Baesponse, error) {
+	key, cs, args, missing := ph.whose(e, args)
+	if missing != nil {
+		return missing, nil
+	}
+	if len(args) < 1 {
+		return say("Try !heal [character] <amount>."), nil
+	}
+	amount, rolled, err := ph.rollAmount(strings.Join(args, ""))
+	if err != nil {
+		return say(err.Error() + "."), nil
+	}
+	var msg string
+	err = ph.overlays.update(key, func(o *overlay) error {
+		drama, err := o.heal(cs, amount)
+		if err != nil {
+			return err
+		}
+		msg = fmt.Sprintf("%s heals %d%s, now at %s.%s", cs.PlayerName, amount, rolled, fmtHP(cs, o), drama)
+		return nil
+	})
+	if err != nil {
+		return say(err.Error() + "."), nil
+	}
+	return say(msg), nil
+}
+
+// TempHPHandler returns a handler for "!temphp [character] <amount>". Temp HP
+// doesn't stack, so the character keeps whichever is higher.
+func (ph *PlayerHandler) TempHPHandler() baepi.BaeSayHandler {
+	return &command{hotword: "temphp", say: ph.tempHP}
+}
+
+func (ph *PlayerHandler) tempHP(db baepi.DiceBae, e *baepi.Baevent, args []string) (*baepi.Baesponse, error) {
+	key, cs, args, missing := ph.whose(e, args)
+	if missing != nil {
+		return missing, nil
+	}
+	if len(args) < 1 {
+		return say("Try !temphp [character] <amount>."), nil
+	}
+	amount, rolled, err := ph.rollAmount(strings.Join(args, ""))
+	if err != nil {
+		return say(err.Error() + "."), nil
+	}
+	var msg string
+	err = ph.overlays.update(key, func(o *overlay) error {
+		o.hp(cs)
+		if amount <= o.TempHP {
+			msg = fmt.Sprintf("%s already has %d temp HP%s, which doesn't stack.", cs.PlayerName, o.TempHP, rolled)
+			return nil
+		}
+		o.TempHP = amount
+		msg = fmt.Sprintf("%s gets %d temp HP%s, now at %s.", cs.PlayerName, amount, rolled, fmtHP(cs, o))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return say(msg), nil
+}
+
+// DeathSaveHandler returns a handler for "!deathsave [character]", for
+// characters at 0 HP.
+func (ph *PlayerHandler) DeathSaveHandler() baepi.BaeSayHandler {
+	return &command{hotword: "deathsave", say: ph.deathSave}
+}
+
+func (ph *PlayerHandler) deathSave(db baepi.DiceBae, e *baepi.Baevent, args []string) (*baepi.Baesponse, error) {
+	key, cs, args, missing := ph.whose(e, args)
+	if missing != nil {
+		return missing, nil
+	}
+	if len(args) != 0 {
+		return say("Try !deathsave [character]."), nil
+	}
+	var resp *baepi.Baesponse
+	err := ph.overlays.update(key, func(o *overlay) error {
+		switch {
+		case o.hp(cs) > 0:
+			resp = say(fmt.Sprintf("%s isn't dying, they have %s.", cs.PlayerName, fmtHP(cs, o)))
+			return nil
+		case o.dead():
+			resp = say(fmt.Sprintf("%s is dead. No more saves.", cs.PlayerName))
+			return nil
+		case o.DeathSaves.Stable:
+			resp = say(fmt.Sprintf("%s is stable, no need to roll.", cs.PlayerName))
+			return nil
+		}
+		resp = ph.rollD20(0, roll.NoAdvantage, effects(o.Conditions, saveRoll, ""), fmt.Sprintf("%s's death save", cs.PlayerName))
+		res := resp.HandlerMetadata.(roll.RollResponse)
+		switch {
+		case res.Results[0].IsCrit:
+			o.setHP(1)
+			o.DeathSaves = deathSaves{}
+			resp.Message += fmt.Sprintf(" **%s is back up with 1 HP!**", cs.PlayerName)
+			return nil
+		case res.Results[0].IsCritFail:
+			o.DeathSaves.Failures += 2
+		case res.Total >= 10:
+			o.DeathSaves.Successes++
+		default:
+			o.DeathSaves.Failures++
+		}
+		switch {
+		case o.dead():
+			resp.Message += fmt.Sprintf(" **%s is dead.**", cs.PlayerName)
+		case o.DeathSaves.Successes >= 3:
+			o.DeathSaves = deathSaves{Stable: true}
+			resp.Message += fmt.Sprintf(" **%s is stable.**", cs.PlayerName)
+		default:
+			resp.Message += fmt.Sprintf(" (%s)", o.DeathSaves)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
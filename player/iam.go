@@ -0,0 +1,181 @@
+package player
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+
+	"dicebae/baepi"
+)
+
+// bindingStore remembers which character each Discord user plays in each
+// guild, saving to a file after every change if it has one.
+type bindingStore struct {
+	path string
+	mu   sync.Mutex
+	// bindings maps guild IDs to user IDs to character keys.
+	bindings map[string]map[string]string
+}
+
+func newBindingStore(path string) (*bindingStore, error) {
+	st := &bindingStore{path: path, bindings: make(map[string]map[string]string)}
+	if path == "" {
+		return st, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read character bindings: %v", err)
+	}
+	if err := json.Unmarshal(b, &st.bindings); err != nil {
+		return nil, fmt.Errorf("failed to parse character bindings %q: %v", path, err)
+	}
+	return st, nil
+}
+
+// get returns the key of the character a user plays in a guild, or "" if they
+// haven't said.
+func (st *bindingStore) get(guildID, userID string) string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.bindings[guildID][userID]
+}
+
+func (st *bindingStore) set(guildID, userID, key string) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.bindings[guildID] == nil {
+		st.bindings[guildID] = make(map[string]string)
+	}
+	st.bindings[guildID][userID] = key
+	if st.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(st.bindings, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal character bindings: %v", err)
+	}
+	return writeFileAtomic(st.path, b)
+}
+
+// IAmHandler returns a handler for "!iam <character>", which tells the bae
+// who's playing which character in the guild, so they can leave their name off
+// commands.
+// A bare "!iam" asks who the bae thinks you are.
+func (ph *PlayerHandler) IAmHandler() baepi.BaeSayHandler {
+	return &command{hotword: "iam", say: ph.iam}
+}
+
+func (ph *PlayerHandler) iam(db baepi.DiceBae, e *baepi.Baevent, args []string) (*baepi.Baesponse, error) {
+	if len(args) == 0 {
+		if _, cs := ph.boundSheet(e.GuildID, e.Speaker); cs != nil {
+			return say(fmt.Sprintf("You're %s.", cs.PlayerName)), nil
+		}
+		return say("No idea who you are. Try !iam <character>."), nil
+	}
+	key, cs, ambiguous := ph.lookup(e.GuildID, strings.Join(args, " "))
+	if len(ambiguous) > 0 {
+		return say(didYouMean(ambiguous)), nil
+	}
+	if cs == nil {
+		return say(fmt.Sprintf("Who's %s?", strings.Join(args, " "))), nil
+	}
+	if err := ph.bindings.set(e.GuildID, e.Speaker.ID, key); err != nil {
+		return nil, err
+	}
+	return say(fmt.Sprintf("Hi %s!", cs.PlayerName)), nil
+}
+
+// boundSheet returns the key and sheet of the character a user plays in a
+// guild, or a nil sheet if they haven't said or it hasn't loaded.
+func (ph *PlayerHandler) boundSheet(guildID string, speaker *baepi.BaestFriend) (string, *CharacterSheet) {
+	if speaker == nil {
+		return "", nil
+	}
+	key := ph.bindings.get(guildID, speaker.ID)
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	if c := ph.characters[key]; c != nil {
+		return key, c.sheet
+	}
+	return "", nil
+}
+
+// whose works out which character a command is about: the one named by its
+// first argument, or else the speaker's own. Speakers with a character of
+// their own have to name others exactly, by name, part of one or alias, so
+// arguments like "!attack dagger" aren't mistaken for a near miss of "Danger".
+// It returns the remaining arguments, or a reply explaining who's missing.
+func (ph *PlayerHandler) whose(e *baepi.Baevent, args []string) (string, *CharacterSheet, []string, *baepi.Baesponse) {
+	boundKey, bound := ph.boundSheet(e.GuildID, e.Speaker)
+	if len(args) > 0 {
+		level := nearMisses
+		if bound != nil {
+			level = nameParts
+		}
+		key, cs, ambiguous := ph.find(e.GuildID, args[0], level)
+		if len(ambiguous) > 0 {
+			return "", nil, nil, say(didYouMean(ambiguous))
+		}
+		if cs != nil {
+			return key, cs, args[1:], nil
+		}
+	}
+	if bound != nil {
+		return boundKey, bound, args, nil
+	}
+	if len(args) > 0 {
+		return "", nil, nil, say(fmt.Sprintf("Who's %s? If it's you, tell me who you are with !iam <character>.", args[0]))
+	}
+	return "", nil, nil, say("Who, you? Tell me who you are with !iam <character>.")
+}
+
+// ResolveVariable implements roll.VariableResolver, looking up values like
+// @dex, @str.save or @prof on the speaker's character sheet.
+func (ph *PlayerHandler) ResolveVariable(e *baepi.Baevent, name string) (int, error) {
+	key, cs := ph.boundSheet(e.GuildID, e.Speaker)
+	if cs == nil {
+		return 0, fmt.Errorf("@%s needs a character, so tell me who you are with !iam <character>", name)
+	}
+	base, field := name, ""
+	if i := strings.Index(name, "."); i >= 0 {
+		base, field = name[:i], name[i+1:]
+	}
+	if ab := abilityKey(base); ab != "" {
+		switch field {
+		case "", "mod":
+			return cs.Mod(ab), nil
+		case "score":
+			return cs.Score(ab), nil
+		case "save":
+			return cs.SaveBonus(ab), nil
+		case "check":
+			return cs.AbilityCheckBonus(ab), nil
+		}
+		return 0, fmt.Errorf("I don't know what @%s is, try @%s, @%s.score, @%s.save or @%s.check", name, base, base, base, base)
+	}
+	if field != "" {
+		return 0, fmt.Errorf("I don't know what @%s is", name)
+	}
+	switch base {
+	case "prof":
+		return cs.ProficiencyBonus(), nil
+	case "level", "lvl":
+		return cs.Level, nil
+	case "ac":
+		return cs.AC, nil
+	case "init":
+		return cs.Initiative(), nil
+	case "hp":
+		return cs.withOverlay(ph.overlays.get(key)).CurrentHP, nil
+	}
+	if _, ok := skillAbilities[base]; ok {
+		return cs.SkillBonus(base), nil
+	}
+	return 0, fmt.Errorf("I don't know what @%s is", name)
+}
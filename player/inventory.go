@@ -0,0 +1,205 @@
+package player
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"dicebae/baepi"
+)
+
+const (
+	// maxAttuned is how many magic items a character can be attuned to.
+	maxAttuned = 3
+	// maxShownItems keeps big inventories from blowing past Discord's message
+	// limit.
+	maxShownItems = 60
+)
+
+// Item is something a character carries.
+type Item struct {
+	Name     string
+	Type     string
+	Quantity int
+	Equipped bool
+	Attuned  bool
+	Magic    bool
+	Rarity   string
+}
+
+// Coins is a character's money, in each kind of coin.
+type Coins struct {
+	CP int `json:"cp"`
+	SP int `json:"sp"`
+	EP int `json:"ep"`
+	GP int `json:"gp"`
+	PP int `json:"pp"`
+}
+
+func (c Coins) add(o Coins) Coins {
+	return Coins{c.CP + o.CP, c.SP + o.SP, c.EP + o.EP, c.GP + o.GP, c.PP + o.PP}
+}
+
+// gp returns what the coins are worth in gold.
+func (c Coins) gp() float64 {
+	return float64(c.CP)/100 + float64(c.SP)/10 + float64(c.EP)/2 + float64(c.GP) + float64(c.PP)*10
+}
+
+func (c Coins) String() string {
+	var ss []string
+	for _, v := range []struct {
+		n    int
+		kind string
+	}{{c.PP, "pp"}, {c.GP, "gp"}, {c.EP, "ep"}, {c.SP, "sp"}, {c.CP, "cp"}} {
+		if v.n != 0 {
+			ss = append(ss, fmt.Sprintf("%d %s", v.n, v.kind))
+		}
+	}
+	if len(ss) == 0 {
+		return "not a copper"
+	}
+	return strings.Join(ss, ", ")
+}
+
+// setInventory fills in what the character carries, sorted by name.
+func (cs *CharacterSheet) setInventory(p *DNDBeyondJSON) {
+	for _, it := range p.Inventory {
+		cs.Items = append(cs.Items, &Item{
+			Name:     it.Definition.Name,
+			Type:     it.Definition.Type,
+			Quantity: it.Quantity,
+			Equipped: it.Equipped,
+			Attuned:  it.IsAttuned,
+			Magic:    it.Definition.Magic,
+			Rarity:   it.Definition.Rarity,
+		})
+	}
+	sort.SliceStable(cs.Items, func(i, j int) bool { return cs.Items[i].Name < cs.Items[j].Name })
+	cs.Coins = p.Currencies
+}
+
+// matches returns whether an item passes a filter: "equipped", "attuned",
+// "magic", or part of its name, type or rarity.
+func (it *Item) matches(filter string) bool {
+	switch filter {
+	case "":
+		return true
+	case "equipped":
+		return it.Equipped
+	case "attuned":
+		return it.Attuned
+	case "magic":
+		return it.Magic
+	}
+	for _, s := range []string{it.Name, it.Type, it.Rarity} {
+		if strings.Contains(strings.ToLower(s), filter) {
+			return true
+		}
+	}
+	return false
+}
+
+func (it *Item) String() string {
+	s := it.Name
+	if it.Quantity > 1 {
+		s += fmt.Sprintf(" ×%d", it.Quantity)
+	}
+	var notes []string
+	if it.Equipped {
+		notes = append(notes, "equipped")
+	}
+	if it.Attuned {
+		notes = append(notes, "attuned")
+	}
+	if len(notes) > 0 {
+		s += " (" + strings.Join(notes, ", ") + ")"
+	}
+	return s
+}
+
+// fmtInventory formats the character's items that pass a filter, how many
+// they're attuned to, and their coins.
+func (cs *CharacterSheet) fmtInventory(filter string) string {
+	var ss []string
+	attuned := 0
+	for _, it := range cs.Items {
+		if it.Attuned {
+			attuned++
+		}
+		if it.matches(filter) {
+			ss = append(ss, it.String())
+		}
+	}
+	if len(cs.Items) == 0 {
+		return fmt.Sprintf("%s isn't carrying anything I know about.", cs.PlayerName)
+	}
+	if len(ss) == 0 {
+		return fmt.Sprintf("%s has nothing like %q.", cs.PlayerName, filter)
+	}
+	if len(ss) > maxShownItems {
+		ss = append(ss[:maxShownItems], fmt.Sprintf("and %d more, try a filter", len(ss)-maxShownItems))
+	}
+	msg := fmt.Sprintf("**%s's inventory:** %s", cs.PlayerName, strings.Join(ss, ", "))
+	if filter == "" {
+		msg += fmt.Sprintf("\nAttuned to %d/%d items. Coins: %s.", attuned, maxAttuned, cs.Coins)
+	}
+	return msg
+}
+
+// InventoryHandler returns a handler for "!inv [character] [filter]", where
+// the filter is "equipped", "attuned", "magic", or part of an item's name.
+func (ph *PlayerHandler) InventoryHandler() baepi.BaeSayHandler {
+	return &command{hotword: "inv", say: ph.inventory}
+}
+
+func (ph *PlayerHandler) inventory(db baepi.DiceBae, e *baepi.Baevent, args []string) (*baepi.Baesponse, error) {
+	_, cs, args, missing := ph.whose(e, args)
+	if missing != nil {
+		return missing, nil
+	}
+	return say(cs.fmtInventory(strings.ToLower(strings.Join(args, " ")))), nil
+}
+
+// GoldHandler returns a handler for "!gold [character|party]", showing a
+// character's coins, or everyone's with the party's total.
+func (ph *PlayerHandler) GoldHandler() baepi.BaeSayHandler {
+	return &command{hotword: "gold", say: ph.gold}
+}
+
+func (ph *PlayerHandler) gold(db baepi.DiceBae, e *baepi.Baevent, args []string) (*baepi.Baesponse, error) {
+	if len(args) == 1 && strings.ToLower(args[0]) == "party" && e.GuildID != "" {
+		return say(ph.partyGold(e.GuildID)), nil
+	}
+	_, cs, args, missing := ph.whose(e, args)
+	if missing != nil {
+		return missing, nil
+	}
+	if len(args) > 0 {
+		return say("Try !gold [character|party]."), nil
+	}
+	return say(fmt.Sprintf("%s has %s.", cs.PlayerName, cs.Coins)), nil
+}
+
+// partyGold formats everyone's coins in a guild's party, and their total.
+func (ph *PlayerHandler) partyGold(guildID string) string {
+	var sheets []*CharacterSheet
+	ph.mu.Lock()
+	for _, k := range ph.parties.get(guildID) {
+		if c := ph.characters[k]; c != nil && c.sheet != nil {
+			sheets = append(sheets, c.sheet)
+		}
+	}
+	ph.mu.Unlock()
+	if len(sheets) == 0 {
+		return "There's nobody in the party to have any money."
+	}
+	sort.Slice(sheets, func(i, j int) bool { return sheets[i].PlayerName < sheets[j].PlayerName })
+	var lines []string
+	var total Coins
+	for _, cs := range sheets {
+		lines = append(lines, fmt.Sprintf("%s: %s", cs.PlayerName, cs.Coins))
+		total = total.add(cs.Coins)
+	}
+	lines = append(lines, fmt.Sprintf("**Party total:** %s (worth %.2f gp)", total, total.gp()))
+	return strings.Join(lines, "\n")
+}
@@ -5,77 +5,608 @@ import (
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"time"
 )
 
+// DNDBeyondJSON is a D&D Beyond character, as its JSON endpoints return it.
 type DNDBeyondJSON struct {
-	ID               int           `json:id`
-	Name             string        `json:name`
-	BaseHitPoints    int           `json:baseHitPoints`
-	RemovedHitPoints int           `json:removedHitPoints`
-	Stats            []PlayerStats `json:stats`
-	Modifiers        Modifiers     `json:modifiers`
-	Classes          []PlayerClass
+	ID          int    `json:"id"`
+	UserID      int    `json:"userId"`
+	ReadonlyURL string `json:"readonlyUrl"`
+	Name        string `json:"name"`
+	Gender      string `json:"gender"`
+	Faith       string `json:"faith"`
+	Age         *int   `json:"age"`
+	Hair        string `json:"hair"`
+	Eyes        string `json:"eyes"`
+	Skin        string `json:"skin"`
+	Height      string `json:"height"`
+	Weight      *int   `json:"weight"`
+	AlignmentID *int   `json:"alignmentId"`
+	LifestyleID *int   `json:"lifestyleId"`
+	CurrentXP   int    `json:"currentXp"`
+	Inspiration bool   `json:"inspiration"`
+
+	BaseHitPoints      int            `json:"baseHitPoints"`
+	RemovedHitPoints   int            `json:"removedHitPoints"`
+	TemporaryHitPoints int            `json:"temporaryHitPoints"`
+	BonusHitPoints     *int           `json:"bonusHitPoints"`
+	OverrideHitPoints  *int           `json:"overrideHitPoints"`
+	DeathSaves         DDBDeathSaves  `json:"deathSaves"`
+	Conditions         []DDBCondition `json:"conditions"`
+
+	Stats         []PlayerStats  `json:"stats"`
+	BonusStats    []NullableStat `json:"bonusStats"`
+	OverrideStats []NullableStat `json:"overrideStats"`
+
+	Race       *Race         `json:"race"`
+	Background *Background   `json:"background"`
+	Classes    []PlayerClass `json:"classes"`
+	Feats      []Feat        `json:"feats"`
+	Modifiers  Modifiers     `json:"modifiers"`
+	Choices    Choices       `json:"choices"`
+	Actions    Actions       `json:"actions"`
+
+	Inventory   []InventoryItem `json:"inventory"`
+	CustomItems []CustomItem    `json:"customItems"`
+	Currencies  Coins           `json:"currencies"`
+
+	SpellSlots  []SpellSlots  `json:"spellSlots"`
+	PactMagic   []SpellSlots  `json:"pactMagic"`
+	ClassSpells []ClassSpells `json:"classSpells"`
+	Spells      SpellLists    `json:"spells"`
+
+	// CharacterValues holds the player's customizations, like renamed items
+	// or overridden bonuses.
+	CharacterValues []CharacterValue `json:"characterValues"`
+	Traits          Traits           `json:"traits"`
+	Notes           Notes            `json:"notes"`
+	Campaign        *Campaign        `json:"campaign"`
+}
+
+// DDBDeathSaves are the death saves recorded on D&D Beyond, not the ones the
+// bae tracks herself.
+type DDBDeathSaves struct {
+	FailCount    *int `json:"failCount"`
+	SuccessCount *int `json:"successCount"`
+	IsStabilized bool `json:"isStabilized"`
+}
+
+// DDBCondition is a condition set on D&D Beyond, by ID, e.g., 4 for exhaustion,
+// with its level.
+type DDBCondition struct {
+	ID    int  `json:"id"`
+	Level *int `json:"level"`
 }
 
 type PlayerClass struct {
-	Level      int                   `json:level`
-	Definition PlayerClassDefinition `json:definition`
+	ID                 int                    `json:"id"`
+	Level              int                    `json:"level"`
+	IsStartingClass    bool                   `json:"isStartingClass"`
+	Definition         PlayerClassDefinition  `json:"definition"`
+	SubclassDefinition *PlayerClassDefinition `json:"subclassDefinition"`
+	// ClassFeatures holds the class and subclass features the character has
+	// at their level in the class.
+	ClassFeatures []ClassFeature `json:"classFeatures"`
+}
+
+type ClassFeature struct {
+	Definition FeatureDefinition `json:"definition"`
 }
 
 type PlayerClassDefinition struct {
-	Name    string `json:name`
-	HitDice int    `json:hitDice`
+	ID         int         `json:"id"`
+	Name       string      `json:"name"`
+	HitDice    int         `json:"hitDice"`
+	SpellRules *SpellRules `json:"spellRules"`
+	// SpellCastingAbilityID is the stat ID of the class's spellcasting
+	// ability, if it has one.
+	SpellCastingAbilityID int `json:"spellCastingAbilityId"`
+}
+
+type SpellRules struct {
+	MultiClassSpellSlotDivisor int `json:"multiClassSpellSlotDivisor"`
+	// MultiClassSpellSlotRounding is roundUp for classes like the Artificer
+	// whose levels count rounded up.
+	MultiClassSpellSlotRounding int `json:"multiClassSpellSlotRounding"`
+	// LevelSpellSlots holds, for each class level, the number of slots of each
+	// spell level from 1st to 9th.
+	LevelSpellSlots [][]int `json:"levelSpellSlots"`
 }
 
+const (
+	roundDown = 1
+	roundUp   = 2
+)
+
 type PlayerStats struct {
-	ID    int `json:id`
-	Value int `json:value`
+	ID    int `json:"id"`
+	Value int `json:"value"`
+}
+
+// NullableStat is a bonus to or override of an ability score, which is null
+// unless the player set one.
+type NullableStat struct {
+	ID    int  `json:"id"`
+	Value *int `json:"value"`
+}
+
+type Race struct {
+	EntityRaceID int    `json:"entityRaceId"`
+	BaseRaceName string `json:"baseRaceName"`
+	FullName     string `json:"fullName"`
+	IsSubRace    bool   `json:"isSubRace"`
+	IsHomebrew   bool   `json:"isHomebrew"`
+	// SizeID is 4 for Medium, with smaller sizes below and bigger above.
+	SizeID       int `json:"sizeId"`
+	WeightSpeeds struct {
+		Normal Speeds `json:"normal"`
+	} `json:"weightSpeeds"`
+	RacialTraits []RacialTrait `json:"racialTraits"`
+}
+
+// Speeds holds speeds in feet.
+type Speeds struct {
+	Walk   int `json:"walk"`
+	Fly    int `json:"fly"`
+	Burrow int `json:"burrow"`
+	Swim   int `json:"swim"`
+	Climb  int `json:"climb"`
+}
+
+type RacialTrait struct {
+	Definition FeatureDefinition `json:"definition"`
+}
+
+// FeatureDefinition describes a racial trait, class feature or feat.
+type FeatureDefinition struct {
+	ID            int    `json:"id"`
+	Name          string `json:"name"`
+	Snippet       string `json:"snippet"`
+	Description   string `json:"description"`
+	RequiredLevel int    `json:"requiredLevel"`
+}
+
+type Background struct {
+	HasCustomBackground bool                  `json:"hasCustomBackground"`
+	Definition          *BackgroundDefinition `json:"definition"`
+	CustomBackground    *BackgroundDefinition `json:"customBackground"`
+}
+
+type BackgroundDefinition struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	FeatureName string `json:"featureName"`
+}
+
+type Feat struct {
+	ComponentID     int               `json:"componentId"`
+	ComponentTypeID int               `json:"componentTypeId"`
+	DefinitionID    int               `json:"definitionId"`
+	Definition      FeatureDefinition `json:"definition"`
+}
+
+// Choices holds the options the player picked while building the character,
+// e.g., a fighting style, by source.
+type Choices struct {
+	Race       []Choice `json:"race"`
+	Class      []Choice `json:"class"`
+	Background []Choice `json:"background"`
+	Item       []Choice `json:"item"`
+	Feat       []Choice `json:"feat"`
+}
+
+type Choice struct {
+	ID              string `json:"id"`
+	ParentChoiceID  string `json:"parentChoiceId"`
+	ComponentID     int    `json:"componentId"`
+	ComponentTypeID int    `json:"componentTypeId"`
+	Type            int    `json:"type"`
+	SubType         *int   `json:"subType"`
+	Label           string `json:"label"`
+	IsOptional      bool   `json:"isOptional"`
+	// OptionValue is the ID of the chosen option, if one was.
+	OptionValue *int           `json:"optionValue"`
+	Options     []ChoiceOption `json:"options"`
+}
+
+type ChoiceOption struct {
+	ID          int    `json:"id"`
+	Label       string `json:"label"`
+	Description string `json:"description"`
+}
+
+// CharacterValue is one of the player's customizations of something on their
+// sheet, which is identified by its context. Its value can be a number, a
+// string or a boolean, depending on its type.
+type CharacterValue struct {
+	TypeID        int             `json:"typeId"`
+	Value         json.RawMessage `json:"value"`
+	Notes         *string         `json:"notes"`
+	ValueID       *string         `json:"valueId"`
+	ValueTypeID   *string         `json:"valueTypeId"`
+	ContextID     *string         `json:"contextId"`
+	ContextTypeID *string         `json:"contextTypeId"`
+}
+
+// CustomItem is an item the player made up rather than picked from D&D
+// Beyond's list.
+type CustomItem struct {
+	ID          int      `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Quantity    int      `json:"quantity"`
+	Weight      *float64 `json:"weight"`
+	Cost        *float64 `json:"cost"`
+	Notes       string   `json:"notes"`
+}
+
+type Traits struct {
+	PersonalityTraits string `json:"personalityTraits"`
+	Ideals            string `json:"ideals"`
+	Bonds             string `json:"bonds"`
+	Flaws             string `json:"flaws"`
+	Appearance        string `json:"appearance"`
+}
+
+type Notes struct {
+	Allies              string `json:"allies"`
+	Enemies             string `json:"enemies"`
+	Organizations       string `json:"organizations"`
+	PersonalPossessions string `json:"personalPossessions"`
+	OtherHoldings       string `json:"otherHoldings"`
+	Backstory           string `json:"backstory"`
+	OtherNotes          string `json:"otherNotes"`
+}
+
+type Campaign struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	DMUsername string `json:"dmUsername"`
 }
 
 type Modifiers struct {
-	Race  []Modifier `json:race`
-	Class []Modifier `json:class`
+	Race       []Modifier `json:"race"`
+	Class      []Modifier `json:"class"`
+	Background []Modifier `json:"background"`
+	Item       []Modifier `json:"item"`
+	Feat       []Modifier `json:"feat"`
+	Condition  []Modifier `json:"condition"`
 }
 
 type Modifier struct {
-	ID          string `json:id`
-	EntityID    int    `json:entityId`
-	SubType     string `json:subType`
-	TypeName    string `json:friendlyTypeName`
-	SubTypeName string `json:friendlySubtypeName`
-	Value       int    `json:value`
+	ID          string `json:"id"`
+	EntityID    int    `json:"entityId"`
+	Type        string `json:"type"`
+	SubType     string `json:"subType"`
+	TypeName    string `json:"friendlyTypeName"`
+	SubTypeName string `json:"friendlySubtypeName"`
+	Value       int    `json:"value"`
+	// StatID is the ability a modifier adds, if any, e.g., Con for a
+	// Barbarian's Unarmored Defense.
+	StatID int `json:"statId"`
+	// ComponentID is the ID of whatever grants the modifier, e.g., an item.
+	ComponentID        int   `json:"componentId"`
+	RequiresAttunement bool  `json:"requiresAttunement"`
+	Dice               *Dice `json:"dice"`
+}
+
+// Actions holds the character's special actions by source, including
+// limited-use features like Action Surge.
+type Actions struct {
+	Race  []Action `json:"race"`
+	Class []Action `json:"class"`
+	Feat  []Action `json:"feat"`
+	Item  []Action `json:"item"`
+}
+
+type Action struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description"`
+	Snippet     string      `json:"snippet"`
+	LimitedUse  *LimitedUse `json:"limitedUse"`
+}
+
+// LimitedUse describes how often a feature can be used. Uses may instead come
+// from the proficiency bonus or an ability modifier.
+type LimitedUse struct {
+	MaxUses             int  `json:"maxUses"`
+	NumberUsed          int  `json:"numberUsed"`
+	ResetType           int  `json:"resetType"`
+	UseProficiencyBonus bool `json:"useProficiencyBonus"`
+	StatModifierUsesID  int  `json:"statModifierUsesId"`
+}
+
+// Reset types for limited-use features.
+const (
+	resetShortRest = 1
+	resetLongRest  = 2
+	resetDawn      = 3
+)
+
+// Dice describes dice like 2d6+3.
+type Dice struct {
+	DiceCount  int    `json:"diceCount"`
+	DiceValue  int    `json:"diceValue"`
+	FixedValue int    `json:"fixedValue"`
+	DiceString string `json:"diceString"`
+}
+
+type InventoryItem struct {
+	ID           int  `json:"id"`
+	EntityTypeID int  `json:"entityTypeId"`
+	DefinitionID int  `json:"definitionId"`
+	Equipped     bool `json:"equipped"`
+	IsAttuned    bool `json:"isAttuned"`
+	Quantity     int  `json:"quantity"`
+	// ContainerEntityID is the ID of the bag the item is in, or of the
+	// character if it isn't in one.
+	ContainerEntityID int            `json:"containerEntityId"`
+	ChargesUsed       int            `json:"chargesUsed"`
+	LimitedUse        *LimitedUse    `json:"limitedUse"`
+	Definition        ItemDefinition `json:"definition"`
+}
+
+type ItemDefinition struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	Type       string `json:"type"`
+	FilterType string `json:"filterType"`
+	Magic      bool   `json:"magic"`
+	// AttackType is 1 for melee and 2 for ranged weapons.
+	AttackType int `json:"attackType"`
+	// CategoryID is 1 for simple and 2 for martial weapons.
+	CategoryID       int            `json:"categoryId"`
+	Damage           *Dice          `json:"damage"`
+	DamageType       string         `json:"damageType"`
+	Properties       []ItemProperty `json:"properties"`
+	GrantedModifiers []Modifier     `json:"grantedModifiers"`
+	CanAttune        bool           `json:"canAttune"`
+	Rarity           string         `json:"rarity"`
+	Description      string         `json:"description"`
+	Snippet          string         `json:"snippet"`
+	Weight           float64        `json:"weight"`
+	Cost             *float64       `json:"cost"`
+	IsContainer      bool           `json:"isContainer"`
+	Stackable        bool           `json:"stackable"`
+	Tags             []string       `json:"tags"`
+	// ArmorClass and ArmorTypeID are only set for armor and shields.
+	ArmorClass  int `json:"armorClass"`
+	ArmorTypeID int `json:"armorTypeId"`
+}
+
+type ItemProperty struct {
+	Name  string `json:"name"`
+	Notes string `json:"notes"`
+}
+
+// activeModifiers returns the modifiers from every source, leaving out those
+// granted by items that aren't equipped, or that need attuning and aren't.
+// Item modifiers name the item's definition as their component, so when a
+// character has several of the same item, any one of them will do.
+func (p *DNDBeyondJSON) activeModifiers() []Modifier {
+	items := make(map[int][]*InventoryItem)
+	for i := range p.Inventory {
+		it := &p.Inventory[i]
+		items[it.Definition.ID] = append(items[it.Definition.ID], it)
+	}
+	var ret []Modifier
+	for _, ms := range [][]Modifier{p.Modifiers.Race, p.Modifiers.Class, p.Modifiers.Background, p.Modifiers.Feat} {
+		ret = append(ret, ms...)
+	}
+	for _, m := range p.Modifiers.Item {
+		its, active := items[m.ComponentID], false
+		for _, it := range its {
+			if it.Equipped && (!m.RequiresAttunement || it.IsAttuned) {
+				active = true
+			}
+		}
+		if len(its) == 0 || active {
+			ret = append(ret, m)
+		}
+	}
+	return ret
 }
 
 type SpellSlots struct {
-	Level     int `json:level`
-	Used      int `json:used`
-	Available int `json:available`
+	Level     int `json:"level"`
+	Used      int `json:"used"`
+	Available int `json:"available"`
+}
+
+// ClassSpells holds the spells a character knows or has prepared through one
+// of their classes.
+type ClassSpells struct {
+	CharacterClassID int              `json:"characterClassId"`
+	Spells           []CharacterSpell `json:"spells"`
+}
+
+// SpellLists holds spells granted by things other than classes.
+type SpellLists struct {
+	Race  []CharacterSpell `json:"race"`
+	Class []CharacterSpell `json:"class"`
+	Item  []CharacterSpell `json:"item"`
+	Feat  []CharacterSpell `json:"feat"`
+}
+
+type CharacterSpell struct {
+	ID             int  `json:"id"`
+	Prepared       bool `json:"prepared"`
+	AlwaysPrepared bool `json:"alwaysPrepared"`
+	// UsesSpellSlot is false for spells cast some other way, like racial
+	// spells with their own uses.
+	UsesSpellSlot bool            `json:"usesSpellSlot"`
+	CastAtLevel   *int            `json:"castAtLevel"`
+	LimitedUse    *LimitedUse     `json:"limitedUse"`
+	Definition    SpellDefinition `json:"definition"`
+}
+
+type SpellDefinition struct {
+	ID            int    `json:"id"`
+	Name          string `json:"name"`
+	Level         int    `json:"level"`
+	School        string `json:"school"`
+	Concentration bool   `json:"concentration"`
+	Ritual        bool   `json:"ritual"`
+	// SaveDCAbilityID is the stat ID of the ability targets save with, if
+	// they save at all.
+	SaveDCAbilityID     *int   `json:"saveDcAbilityId"`
+	RequiresSavingThrow bool   `json:"requiresSavingThrow"`
+	RequiresAttackRoll  bool   `json:"requiresAttackRoll"`
+	Description         string `json:"description"`
+	Range               struct {
+		Origin     string `json:"origin"`
+		RangeValue *int   `json:"rangeValue"`
+	} `json:"range"`
+	Duration struct {
+		DurationInterval *int    `json:"durationInterval"`
+		DurationUnit     *string `json:"durationUnit"`
+		DurationType     string  `json:"durationType"`
+	} `json:"duration"`
+	// ScaleType is "spellscale" for spells that get better with higher slots
+	// and "characterlevel" for cantrips that get better as characters level.
+	ScaleType string          `json:"scaleType"`
+	Modifiers []SpellModifier `json:"modifiers"`
+}
+
+type SpellModifier struct {
+	Type           string `json:"type"`
+	SubType        string `json:"subType"`
+	Die            *Dice  `json:"die"`
+	AtHigherLevels struct {
+		HigherLevelDefinitions []HigherLevelDefinition `json:"higherLevelDefinitions"`
+	} `json:"atHigherLevels"`
+}
+
+// HigherLevelDefinition is extra dice at a higher level. For spell scaling
+// the level is the number of slot levels above the spell's, for cantrips it's
+// the character level.
+type HigherLevelDefinition struct {
+	Level int   `json:"level"`
+	Dice  *Dice `json:"dice"`
 }
 
-func (ph *PlayerHandler) fetchPlayerJSON(playerID int) (*DNDBeyondJSON, error) {
+// fetchPlayerJSON returns a character's JSON, from the cache if it's younger
+// than the cache TTL and force isn't set, otherwise from D&D Beyond. Refetches
+// are conditional on the cached version's ETag and Last-Modified headers.
+func (d *dndBeyond) fetchPlayerJSON(playerID int, force bool) (*DNDBeyondJSON, error) {
+	cached := d.cache.get(playerID)
+	if cached != nil && !force && time.Since(cached.FetchedAt) < d.cacheTTL {
+		return decodePlayerJSON(cached.Body)
+	}
+
 	url := fmt.Sprintf("https://www.dndbeyond.com/character/%d/json", playerID)
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create an http request: %v", err)
 	}
 	req.Header.Set("User-Agent", "dicebae")
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
 
-	res, err := ph.client.Do(req)
+	res, err := d.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("http request failed: %v", err)
 	}
 	if res.Body != nil {
 		defer res.Body.Close()
 	}
+	if res.StatusCode == http.StatusNotModified && cached != nil {
+		cj := *cached
+		cj.FetchedAt = time.Now()
+		if err := d.cache.put(playerID, &cj); err != nil {
+			fmt.Printf("Failed to cache character %d: %v\n", playerID, err)
+		}
+		return decodePlayerJSON(cj.Body)
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("http request failed: %s", res.Status)
+	}
 
 	body, err := ioutil.ReadAll(res.Body)
 	if err != nil {
 		return nil, fmt.Errorf("reading http result body failed: %v", err)
 	}
+	p, err := decodePlayerJSON(body)
+	if err != nil {
+		return nil, err
+	}
+	cj := &cachedJSON{
+		FetchedAt:    time.Now(),
+		ETag:         res.Header.Get("ETag"),
+		LastModified: res.Header.Get("Last-Modified"),
+		Body:         body,
+	}
+	if err := d.cache.put(playerID, cj); err != nil {
+		fmt.Printf("Failed to cache character %d: %v\n", playerID, err)
+	}
+	return p, nil
+}
+
+// ddbEnvelope wraps characters from D&D Beyond's newer character service.
+type ddbEnvelope struct {
+	Success *bool           `json:"success"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
 
+// decodePlayerJSON decodes a character, with or without the envelope newer
+// endpoints wrap it in, and checks it has what the bae can't do without.
+func decodePlayerJSON(body []byte) (*DNDBeyondJSON, error) {
+	var env ddbEnvelope
+	if err := json.Unmarshal(body, &env); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal json: %v", err)
+	}
+	if env.Success != nil && !*env.Success {
+		return nil, fmt.Errorf("D&D Beyond says no: %s", env.Message)
+	}
+	if len(env.Data) > 0 && string(env.Data) != "null" {
+		body = env.Data
+	}
 	p := &DNDBeyondJSON{}
 	if err := json.Unmarshal(body, p); err != nil {
 		return nil, fmt.Errorf("failed to unmarshal json: %v", err)
 	}
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("character JSON doesn't look right, maybe D&D Beyond changed it: %v", err)
+	}
 	return p, nil
 }
+
+// validate checks a decoded character has the fields the bae needs, so changes
+// to D&D Beyond's format fail loudly instead of making everyone level 0 with
+// all 10s.
+func (p *DNDBeyondJSON) validate() error {
+	if p.ID == 0 {
+		return fmt.Errorf("no id")
+	}
+	if p.Name == "" {
+		return fmt.Errorf("no name")
+	}
+	seen := make(map[int]bool)
+	for _, s := range p.Stats {
+		if s.ID < 1 || s.ID > 6 {
+			return fmt.Errorf("unknown stat id %d", s.ID)
+		}
+		seen[s.ID] = true
+	}
+	if len(seen) != 6 {
+		return fmt.Errorf("want 6 ability scores, got %d", len(seen))
+	}
+	if len(p.Classes) == 0 {
+		return fmt.Errorf("no classes")
+	}
+	for _, c := range p.Classes {
+		if c.Definition.Name == "" || c.Level < 1 {
+			return fmt.Errorf("class %d has no name or level", c.ID)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,235 @@
+package player
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// loadFixture decodes a recorded D&D Beyond payload from testdata.
+func loadFixture(t *testing.T, name string) *DNDBeyondJSON {
+	t.Helper()
+	b, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", name, err)
+	}
+	p, err := decodePlayerJSON(b)
+	if err != nil {
+		t.Fatalf("decodePlayerJSON(%s) = %v", name, err)
+	}
+	return p
+}
+
+func TestDecodeBare(t *testing.T) {
+	p := loadFixture(t, "ddb_bare.json")
+	if p.ID != 41257386 || p.Name != "Brakka Stonefist" {
+		t.Errorf("got character %d %q, want 41257386 \"Brakka Stonefist\"", p.ID, p.Name)
+	}
+	if len(p.Classes) != 1 || p.Classes[0].Definition.Name != "Fighter" || p.Classes[0].Level != 3 {
+		t.Errorf("got classes %+v, want Fighter 3", p.Classes)
+	}
+	if p.Campaign == nil || p.Campaign.Name != "Tuesday Night Dice" {
+		t.Errorf("got campaign %+v, want Tuesday Night Dice", p.Campaign)
+	}
+
+	cs := newCharacterSheet(p)
+	if cs.Con != 16 {
+		t.Errorf("got Con %d, want 16 with the dwarf's +2", cs.Con)
+	}
+	if cs.TotalHP != 31 || cs.CurrentHP != 26 {
+		t.Errorf("got %d/%d HP, want 26/31", cs.CurrentHP, cs.TotalHP)
+	}
+	if cs.AC != 18 {
+		t.Errorf("got AC %d, want 18 from chain mail and a shield", cs.AC)
+	}
+	if cs.Speed != 25 {
+		t.Errorf("got speed %d, want 25", cs.Speed)
+	}
+	if !cs.Resistances["poison"] {
+		t.Errorf("got resistances %v, want poison", cs.Resistances)
+	}
+	if len(cs.Weapons) != 1 || !cs.Weapons[0].Proficient || cs.Weapons[0].Versatile != "1d10" {
+		t.Errorf("got weapons %+v, want a proficient, versatile longsword", cs.Weapons)
+	}
+	want := []*Feature{{Name: "Action Surge", MaxUses: 1, ShortRest: true}, {Name: "Second Wind", MaxUses: 1, ShortRest: true}}
+	if !reflect.DeepEqual(cs.Features, want) {
+		t.Errorf("got features %+v, want %+v", cs.Features, want)
+	}
+	if got, want := cs.FeatureNames, []string{"Dwarven Resilience", "Second Wind", "Action Surge", "Improved Critical"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got feature names %v, want %v", got, want)
+	}
+	if cs.SpellSlots != [9]int{} || cs.PactSlots != 0 {
+		t.Errorf("got slots %v and %d pact slots, want none", cs.SpellSlots, cs.PactSlots)
+	}
+	if got := cs.Coins; got != (Coins{SP: 4, GP: 15}) {
+		t.Errorf("got coins %+v, want 15 gp, 4 sp", got)
+	}
+}
+
+func TestDecodeEnvelope(t *testing.T) {
+	p := loadFixture(t, "ddb_envelope.json")
+	if p.ID != 58110274 || p.Name != "Quill Amberleaf" {
+		t.Errorf("got character %d %q, want 58110274 \"Quill Amberleaf\"", p.ID, p.Name)
+	}
+	if len(p.Conditions) != 1 || p.Conditions[0].ID != 4 || p.Conditions[0].Level == nil || *p.Conditions[0].Level != 1 {
+		t.Errorf("got conditions %+v, want exhaustion 1", p.Conditions)
+	}
+	if len(p.CustomItems) != 1 || p.CustomItems[0].Name != "Grandmother's Spectacles" {
+		t.Errorf("got custom items %+v, want the spectacles", p.CustomItems)
+	}
+	if p.Background == nil || !p.Background.HasCustomBackground || p.Background.CustomBackground.Name != "Disgraced Archivist" {
+		t.Errorf("got background %+v, want a custom one", p.Background)
+	}
+
+	cs := newCharacterSheet(p)
+	if cs.Class != "Wizard" || cs.Level != 1 {
+		t.Errorf("got %s %d, want Wizard 1", cs.Class, cs.Level)
+	}
+	if cs.Int != 16 {
+		t.Errorf("got Int %d, want 16 with the elf's +1", cs.Int)
+	}
+	if cs.TotalHP != 7 || cs.TempHP != 3 {
+		t.Errorf("got %d HP and %d temp, want 7 and 3", cs.TotalHP, cs.TempHP)
+	}
+	if cs.SpellSlots[0] != 2 {
+		t.Errorf("got %d 1st-level slots, want 2", cs.SpellSlots[0])
+	}
+	if got, want := spellNames(cs), []string{"Fire Bolt", "Magic Missile"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got spells %v, want %v", got, want)
+	}
+}
+
+func TestDecodeMulticlass(t *testing.T) {
+	p := loadFixture(t, "ddb_multiclass.json")
+	if p.Name != "Kira Vantari" {
+		t.Errorf("got name %q, want \"Kira Vantari\"", p.Name)
+	}
+	var feats []string
+	for _, f := range p.Feats {
+		feats = append(feats, f.Definition.Name)
+	}
+	if want := []string{"Resilient", "War Caster"}; !reflect.DeepEqual(feats, want) {
+		t.Errorf("got feats %v, want %v", feats, want)
+	}
+	if len(p.Choices.Class) != 1 || p.Choices.Class[0].OptionValue == nil || *p.Choices.Class[0].OptionValue != 7 {
+		t.Errorf("got class choices %+v, want the Defense fighting style", p.Choices.Class)
+	}
+	if len(p.Choices.Race) != 1 || len(p.Choices.Feat) != 1 {
+		t.Errorf("got %d race and %d feat choices, want 1 each", len(p.Choices.Race), len(p.Choices.Feat))
+	}
+	if len(p.CharacterValues) != 2 || string(p.CharacterValues[1].Value) != "true" {
+		t.Errorf("got character values %+v, want a name and a boolean", p.CharacterValues)
+	}
+
+	cs := newCharacterSheet(p)
+	if cs.Level != 8 || cs.fmtClasses() != "Paladin 5 / Warlock 3" {
+		t.Errorf("got level %d %s, want 8 Paladin 5 / Warlock 3", cs.Level, cs.fmtClasses())
+	}
+	if cs.Classes[1].Subclass != "The Hexblade" || cs.Classes[1].SpellAbility != "cha" {
+		t.Errorf("got warlock %+v, want a Charisma-casting Hexblade", cs.Classes[1])
+	}
+	if cs.Cha != 17 || cs.Con != 15 {
+		t.Errorf("got Cha %d and Con %d, want 17 and 15 from race and feat", cs.Cha, cs.Con)
+	}
+	if cs.TotalHP != 65 || cs.CurrentHP != 55 {
+		t.Errorf("got %d/%d HP, want 55/65", cs.CurrentHP, cs.TotalHP)
+	}
+	// Half plate, a shield, the Defense style and the attuned ring, but not
+	// the cloak, which isn't attuned.
+	if cs.AC != 19 {
+		t.Errorf("got AC %d, want 19", cs.AC)
+	}
+	if cs.SaveBonuses["all"] != 1 || cs.SaveBonus("con") != 6 {
+		t.Errorf("got save bonus %d and Con save %+d, want 1 and +6", cs.SaveBonuses["all"], cs.SaveBonus("con"))
+	}
+	if cs.SpellSlots != [9]int{4, 2} || cs.PactSlots != 2 || cs.PactSlotLevel != 2 {
+		t.Errorf("got slots %v and %d pact slots at %d, want [4 2], 2 at 2nd", cs.SpellSlots, cs.PactSlots, cs.PactSlotLevel)
+	}
+	if got, want := spellNames(cs), []string{"Eldritch Blast", "Bless", "Hex", "Searing Smite", "Shatter"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got spells %v, want %v", got, want)
+	}
+	want := []*Feature{
+		{Name: "Channel Divinity", MaxUses: 1, ShortRest: true},
+		{Name: "Divine Sense", MaxUses: 3},
+		{Name: "Hexblade's Curse", MaxUses: 1, ShortRest: true},
+		{Name: "Lay on Hands", MaxUses: 25},
+	}
+	if !reflect.DeepEqual(cs.Features, want) {
+		t.Errorf("got features %+v, want %+v", cs.Features, want)
+	}
+	if len(cs.Weapons) != 1 || cs.Weapons[0].Magic != 1 || !cs.Weapons[0].Proficient {
+		t.Errorf("got weapons %+v, want a proficient +1 longsword", cs.Weapons)
+	}
+	if len(cs.Items) != 6 {
+		t.Errorf("got %d items, want 6", len(cs.Items))
+	}
+	if got := cs.Coins; got != (Coins{SP: 7, GP: 120, PP: 2}) {
+		t.Errorf("got coins %+v, want 2 pp, 120 gp, 7 sp", got)
+	}
+}
+
+func spellNames(cs *CharacterSheet) []string {
+	var names []string
+	for _, sp := range cs.Spells {
+		names = append(names, sp.Name)
+	}
+	return names
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		desc   string
+		mangle func(p *DNDBeyondJSON)
+		want   string
+	}{
+		{"no id", func(p *DNDBeyondJSON) { p.ID = 0 }, "no id"},
+		{"no name", func(p *DNDBeyondJSON) { p.Name = "" }, "no name"},
+		{"missing stat", func(p *DNDBeyondJSON) { p.Stats = p.Stats[:5] }, "want 6 ability scores"},
+		{"unknown stat", func(p *DNDBeyondJSON) { p.Stats[0].ID = 7 }, "unknown stat id 7"},
+		{"no classes", func(p *DNDBeyondJSON) { p.Classes = nil }, "no classes"},
+		{"no class level", func(p *DNDBeyondJSON) { p.Classes[0].Level = 0 }, "has no name or level"},
+		{"no class name", func(p *DNDBeyondJSON) { p.Classes[0].Definition.Name = "" }, "has no name or level"},
+	} {
+		p := loadFixture(t, "ddb_bare.json")
+		tc.mangle(p)
+		if err := p.validate(); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: validate() = %v, want an error with %q", tc.desc, err, tc.want)
+		}
+	}
+}
+
+func TestDecodeBroken(t *testing.T) {
+	bare, err := ioutil.ReadFile(filepath.Join("testdata", "ddb_bare.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(bare, &raw); err != nil {
+		t.Fatal(err)
+	}
+	delete(raw, "stats")
+	noStats, err := json.Marshal(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		desc string
+		body string
+		want string
+	}{
+		{"not json", "<html>Down for maintenance</html>", "failed to unmarshal json"},
+		{"no stats", string(noStats), "want 6 ability scores, got 0"},
+		{"wrong shape", `{"id": 1, "name": "Bob", "stats": {"str": 10}}`, "failed to unmarshal json"},
+		{"refused", `{"success": false, "message": "Character is private.", "data": null}`, "D&D Beyond says no: Character is private."},
+		{"empty envelope", `{"success": true, "message": "", "data": {}}`, "no id"},
+		{"enveloped no stats", `{"success": true, "data": ` + string(noStats) + `}`, "want 6 ability scores, got 0"},
+	} {
+		if _, err := decodePlayerJSON([]byte(tc.body)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: decodePlayerJSON() = %v, want an error with %q", tc.desc, err, tc.want)
+		}
+	}
+}
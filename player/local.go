@@ -0,0 +1,181 @@
+package player
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// localSheet is the format of hand-written character sheets, for homebrew
+// characters and NPCs that don't live on D&D Beyond. It can be written as
+// JSON or YAML, e.g.:
+//
+//	name: Grub the Unwashed
+//	class: Barbarian
+//	level: 3
+//	hp: 31
+//	maxHp: 35
+//	ac: 14
+//	str: 17
+//	dex: 13
+//	proficiencies: [athletics, intimidation]
+//	saves: [str, con]
+//	resistances: [poison]
+//	weapons:
+//	  - {name: Greataxe, damage: 1d12, damageType: slashing, proficient: true}
+type localSheet struct {
+	Name  string `json:"name"`
+	Class string `json:"class"`
+	Level int    `json:"level"`
+	// Classes is for multiclass characters, instead of class and level.
+	Classes []localClass `json:"classes"`
+	HP      int          `json:"hp"`
+	MaxHP   int          `json:"maxHp"`
+	AC      int          `json:"ac"`
+	Speed   int          `json:"speed"`
+	// SpellAbility is the ability the character casts spells with, if any.
+	SpellAbility string `json:"spellAbility"`
+
+	Str int `json:"str"`
+	Dex int `json:"dex"`
+	Con int `json:"con"`
+	Int int `json:"int"`
+	Wis int `json:"wis"`
+	Cha int `json:"cha"`
+
+	// Skills the character is proficient in, and has expertise in.
+	Proficiencies []string `json:"proficiencies"`
+	Expertise     []string `json:"expertise"`
+	// Abilities the character is proficient in saving throws for.
+	Saves   []string      `json:"saves"`
+	Weapons []localWeapon `json:"weapons"`
+	// Damage types the character resists, ignores, or takes double from.
+	Resistances     []string `json:"resistances"`
+	Immunities      []string `json:"immunities"`
+	Vulnerabilities []string `json:"vulnerabilities"`
+}
+
+type localClass struct {
+	Name         string `json:"name"`
+	Subclass     string `json:"subclass"`
+	Level        int    `json:"level"`
+	HitDie       int    `json:"hitDie"`
+	SpellAbility string `json:"spellAbility"`
+}
+
+type localWeapon struct {
+	Name       string `json:"name"`
+	Damage     string `json:"damage"`
+	DamageType string `json:"damageType"`
+	Versatile  string `json:"versatile"`
+	Finesse    bool   `json:"finesse"`
+	Ranged     bool   `json:"ranged"`
+	Proficient bool   `json:"proficient"`
+	Magic      int    `json:"magic"`
+}
+
+// fileSource loads a character from a local JSON or YAML sheet. Files are
+// cheap to read, so every load rereads the file.
+type fileSource struct {
+	path string
+}
+
+func (s *fileSource) Key() string {
+	return "file:" + s.path
+}
+
+func (s *fileSource) Load(force bool) (*CharacterSheet, error) {
+	b, err := ioutil.ReadFile(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read character sheet: %v", err)
+	}
+	switch strings.ToLower(filepath.Ext(s.path)) {
+	case ".yaml", ".yml":
+		if b, err = yamlToJSON(b); err != nil {
+			return nil, fmt.Errorf("failed to parse character sheet %q: %v", s.path, err)
+		}
+	}
+	ls := &localSheet{}
+	if err := json.Unmarshal(b, ls); err != nil {
+		return nil, fmt.Errorf("failed to parse character sheet %q: %v", s.path, err)
+	}
+	if ls.Name == "" {
+		return nil, fmt.Errorf("character sheet %q has no name", s.path)
+	}
+	return ls.characterSheet(), nil
+}
+
+func (s *fileSource) Cached() (*CharacterSheet, time.Time) {
+	return nil, time.Time{}
+}
+
+// skillKey turns a hand-written skill name like "Sleight of Hand" into the
+// form D&D Beyond uses.
+func skillKey(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), "-"))
+}
+
+func (ls *localSheet) characterSheet() *CharacterSheet {
+	cs := &CharacterSheet{
+		PlayerName: ls.Name,
+		CurrentHP:  ls.HP,
+		TotalHP:    ls.MaxHP,
+		AC:         ls.AC,
+		Speed:      ls.Speed,
+		Str:        ls.Str,
+		Dex:        ls.Dex,
+		Con:        ls.Con,
+		Int:        ls.Int,
+		Wis:        ls.Wis,
+		Cha:        ls.Cha,
+	}
+	if cs.TotalHP == 0 {
+		cs.TotalHP = cs.CurrentHP
+	}
+	for _, lc := range ls.Classes {
+		cs.addClass(ClassLevel{
+			Name:         lc.Name,
+			Subclass:     lc.Subclass,
+			Level:        lc.Level,
+			HitDie:       lc.HitDie,
+			SpellAbility: abilityKey(lc.SpellAbility),
+		})
+	}
+	if len(ls.Classes) == 0 && (ls.Class != "" || ls.Level > 0) {
+		cs.addClass(ClassLevel{Name: ls.Class, Level: ls.Level, SpellAbility: abilityKey(ls.SpellAbility)})
+	}
+	for _, sk := range ls.Proficiencies {
+		cs.addProficiency(skillKey(sk), Proficient)
+	}
+	for _, sk := range ls.Expertise {
+		cs.addProficiency(skillKey(sk), Expertise)
+	}
+	for _, ab := range ls.Saves {
+		cs.addSaveProficiency(abilityKey(ab))
+	}
+	for _, t := range ls.Resistances {
+		cs.addDefense("resistance", t)
+	}
+	for _, t := range ls.Immunities {
+		cs.addDefense("immunity", t)
+	}
+	for _, t := range ls.Vulnerabilities {
+		cs.addDefense("vulnerability", t)
+	}
+	for _, lw := range ls.Weapons {
+		cs.Weapons = append(cs.Weapons, &Weapon{
+			Name:       lw.Name,
+			Damage:     lw.Damage,
+			DamageType: lw.DamageType,
+			Versatile:  lw.Versatile,
+			Finesse:    lw.Finesse,
+			Ranged:     lw.Ranged,
+			Proficient: lw.Proficient,
+			Magic:      lw.Magic,
+		})
+	}
+	return cs
+}
@@ -0,0 +1,177 @@
+package player
+
+import (
+	"sort"
+	"strings"
+)
+
+// nameResolver finds characters by whatever people call them: full names,
+// any part of a name, configured aliases, prefixes, or near misses.
+type nameResolver struct {
+	names []*charName
+	// aliases maps lowercase nicknames to the names they stand for.
+	aliases map[string]string
+}
+
+type charName struct {
+	key     string
+	display string
+	full    string
+	parts   []string
+}
+
+// matchLevel is how loosely a name can match a character.
+type matchLevel int
+
+const (
+	// fullNames only matches whole names, and aliases for them.
+	fullNames matchLevel = iota
+	// nameParts also matches any part of a name, like a first name.
+	nameParts
+	// nearMisses also matches prefixes of names and their parts, and typos.
+	nearMisses
+)
+
+func newNameResolver(aliases map[string]string) *nameResolver {
+	nr := &nameResolver{aliases: make(map[string]string)}
+	for a, n := range aliases {
+		nr.aliases[normalizeName(a)] = n
+	}
+	return nr
+}
+
+// normalizeName lowercases a name and collapses its whitespace.
+func normalizeName(n string) string {
+	return strings.Join(strings.Fields(strings.ToLower(n)), " ")
+}
+
+// add indexes a character by name, replacing any name it had before.
+func (nr *nameResolver) add(display, key string) {
+	nr.remove(key)
+	full := normalizeName(display)
+	nr.names = append(nr.names, &charName{
+		key:     key,
+		display: display,
+		full:    full,
+		parts:   strings.Fields(full),
+	})
+	sort.Slice(nr.names, func(i, j int) bool { return nr.names[i].full < nr.names[j].full })
+}
+
+func (nr *nameResolver) remove(key string) {
+	for i, cn := range nr.names {
+		if cn.key == key {
+			nr.names = append(nr.names[:i], nr.names[i+1:]...)
+			return
+		}
+	}
+}
+
+// resolve returns the characters best matching a name, among those ok allows.
+// More than one means the name is ambiguous; none means nobody's close. level
+// says how loose a match counts.
+func (nr *nameResolver) resolve(name string, ok func(key string) bool, level matchLevel) []*charName {
+	q := normalizeName(name)
+	if q == "" {
+		return nil
+	}
+	if n, isAlias := nr.aliases[q]; isAlias {
+		if found := nr.match(normalizeName(n), ok, level); len(found) > 0 {
+			return found
+		}
+	}
+	return nr.match(q, ok, level)
+}
+
+// match tries ever looser ways of matching, up to level, stopping at the first
+// that finds anyone.
+func (nr *nameResolver) match(q string, ok func(key string) bool, level matchLevel) []*charName {
+	tiers := []func(cn *charName) bool{
+		func(cn *charName) bool { return cn.full == q },
+		func(cn *charName) bool { return cn.hasPart(func(p string) bool { return p == q }) },
+		func(cn *charName) bool {
+			return strings.HasPrefix(cn.full, q) || cn.hasPart(func(p string) bool { return strings.HasPrefix(p, q) })
+		},
+		func(cn *charName) bool {
+			d := maxTypos(q)
+			near := func(n string) bool { return len(n) >= minFuzzyLen && levenshtein(n, q) <= d }
+			return d > 0 && (near(cn.full) || cn.hasPart(near))
+		},
+	}
+	if level < nearMisses {
+		tiers = tiers[:level+1]
+	}
+	for _, t := range tiers {
+		var found []*charName
+		for _, cn := range nr.names {
+			if ok(cn.key) && t(cn) {
+				found = append(found, cn)
+			}
+		}
+		if len(found) > 0 {
+			return found
+		}
+	}
+	return nil
+}
+
+func (cn *charName) hasPart(f func(string) bool) bool {
+	for _, p := range cn.parts {
+		if f(p) {
+			return true
+		}
+	}
+	return false
+}
+
+// minFuzzyLen is how long names and the parts of them have to be before typos
+// in them are forgiven, or short words would match everything.
+const minFuzzyLen = 4
+
+// maxTypos returns how many typos a name can have and still match: about one
+// in four letters, and at most two. Short names get none.
+func maxTypos(q string) int {
+	if len(q) < minFuzzyLen || strings.ContainsAny(q, "0123456789") {
+		return 0
+	}
+	if d := len(q) / 4; d < 2 {
+		return d
+	}
+	return 2
+}
+
+// levenshtein returns the edit distance between two strings.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = prev[j] + 1
+			if cur[j-1]+1 < cur[j] {
+				cur[j] = cur[j-1] + 1
+			}
+			if prev[j-1]+cost < cur[j] {
+				cur[j] = prev[j-1] + cost
+			}
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// didYouMean asks which of several characters someone meant.
+func didYouMean(names []string) string {
+	if len(names) == 1 {
+		return "Did you mean " + names[0] + "?"
+	}
+	return "Did you mean " + strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1] + "?"
+}
@@ -0,0 +1,65 @@
+package player
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMaxTypos(t *testing.T) {
+	for q, want := range map[string]int{
+		"bo":               0,
+		"kir":              0,
+		"kira":             1,
+		"danger":           1,
+		"brakka":           1,
+		"stonefist":        2,
+		"brakka stonefist": 2,
+		"bob2":             0,
+	} {
+		if got := maxTypos(q); got != want {
+			t.Errorf("maxTypos(%q) = %d, want %d", q, got, want)
+		}
+	}
+}
+
+func TestResolve(t *testing.T) {
+	nr := newNameResolver(map[string]string{"KK": "Kira Vantari"})
+	nr.add("Kira Vantari", "1")
+	nr.add("Kiran the Bold", "2")
+	nr.add("Danger Noodle", "3")
+	nr.add("Bo", "4")
+	nr.add("Brakka Stonefist", "5")
+	everyone := func(string) bool { return true }
+
+	for _, tc := range []struct {
+		name  string
+		level matchLevel
+		want  []string
+	}{
+		{"kira vantari", fullNames, []string{"1"}},
+		{"kk", fullNames, []string{"1"}},
+		{"kira", fullNames, nil},
+		{"kira", nameParts, []string{"1"}},
+		{"kira", nearMisses, []string{"1"}},
+		{"kir", nearMisses, []string{"1", "2"}},
+		{"vantary", nameParts, nil},
+		{"vantary", nearMisses, []string{"1"}},
+		// Swapping two letters is two typos, too many for a short name.
+		{"kria", nearMisses, nil},
+		// Short names don't forgive typos, or everything would match.
+		{"bp", nearMisses, nil},
+		{"bo", nearMisses, []string{"4"}},
+		{"dagger", nearMisses, []string{"3"}},
+		{"dagger", nameParts, nil},
+		{"stonefsit", nearMisses, []string{"5"}},
+		{"stnfst", nearMisses, nil},
+	} {
+		var got []string
+		for _, cn := range nr.resolve(tc.name, everyone, tc.level) {
+			got = append(got, cn.key)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("resolve(%q, %d) = %v, want %v", tc.name, tc.level, got, tc.want)
+		}
+	}
+}
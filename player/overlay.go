@@ -0,0 +1,139 @@
+package player
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+)
+
+// overlay is what the bae tracks about a character on top of their sheet, like
+// spent spell slots and damage taken. It lasts until whatever resets it, e.g.,
+// a long rest, regardless of what the character's source says.
+type overlay struct {
+	// SlotsUsed holds spent spell slots by level, from 1st at index 0.
+	SlotsUsed [9]int `json:"slotsUsed"`
+	PactUsed  int    `json:"pactUsed"`
+
+	// HP is nil until the bae first hears about damage or healing, and the
+	// sheet's own HP stand.
+	HP         *int       `json:"hp"`
+	TempHP     int        `json:"tempHp"`
+	DeathSaves deathSaves `json:"deathSaves"`
+
+	// HitDiceUsed holds spent hit dice by die size.
+	HitDiceUsed map[int]int `json:"hitDiceUsed"`
+	// FeaturesUsed holds uses of limited-use features by lowercase name.
+	FeaturesUsed map[string]int `json:"featuresUsed"`
+	// Conditions holds the character's conditions, e.g., "poisoned", with
+	// their level, which is only ever more than 1 for exhaustion.
+	Conditions map[string]int `json:"conditions"`
+}
+
+// clone returns a deep copy of the overlay, so changes to it can be thrown
+// away.
+func (o overlay) clone() overlay {
+	if o.HP != nil {
+		hp := *o.HP
+		o.HP = &hp
+	}
+	hd := make(map[int]int)
+	for k, v := range o.HitDiceUsed {
+		hd[k] = v
+	}
+	o.HitDiceUsed = hd
+	fu := make(map[string]int)
+	for k, v := range o.FeaturesUsed {
+		fu[k] = v
+	}
+	o.FeaturesUsed = fu
+	conds := make(map[string]int)
+	for k, v := range o.Conditions {
+		conds[k] = v
+	}
+	o.Conditions = conds
+	return o
+}
+
+type deathSaves struct {
+	Successes int  `json:"successes"`
+	Failures  int  `json:"failures"`
+	Stable    bool `json:"stable"`
+}
+
+// overlayStore keeps every character's overlay, saving them to a file after
+// every change if it has one.
+type overlayStore struct {
+	path     string
+	mu       sync.Mutex
+	overlays map[string]*overlay
+}
+
+func newOverlayStore(path string) (*overlayStore, error) {
+	st := &overlayStore{path: path, overlays: make(map[string]*overlay)}
+	if path == "" {
+		return st, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read character overlays: %v", err)
+	}
+	if err := json.Unmarshal(b, &st.overlays); err != nil {
+		return nil, fmt.Errorf("failed to parse character overlays %q: %v", path, err)
+	}
+	return st, nil
+}
+
+// get returns a copy of a character's overlay.
+func (st *overlayStore) get(key string) overlay {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if o := st.overlays[key]; o != nil {
+		return o.clone()
+	}
+	return overlay{}.clone()
+}
+
+// update applies f to a character's overlay and saves the result. If f returns
+// an error, the overlay is left as it was.
+func (st *overlayStore) update(key string, f func(*overlay) error) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	o := overlay{}.clone()
+	if cur := st.overlays[key]; cur != nil {
+		o = cur.clone()
+	}
+	if err := f(&o); err != nil {
+		return err
+	}
+	st.overlays[key] = &o
+	return st.save()
+}
+
+// save writes every overlay to disk. Callers must hold mu.
+func (st *overlayStore) save() error {
+	if st.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(st.overlays, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal character overlays: %v", err)
+	}
+	return writeFileAtomic(st.path, b)
+}
+
+// writeFileAtomic writes to a temporary file and renames it into place, so a
+// crash never leaves a half-written file behind.
+func writeFileAtomic(path string, b []byte) error {
+	if err := ioutil.WriteFile(path+".tmp", b, 0644); err != nil {
+		return fmt.Errorf("failed to write %q: %v", path, err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return fmt.Errorf("failed to replace %q: %v", path, err)
+	}
+	return nil
+}
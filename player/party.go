@@ -0,0 +1,344 @@
+package player
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"dicebae/baepi"
+)
+
+var errAlreadyInParty = errors.New("already in the party")
+
+// partyStore keeps each guild's roster of character keys, saving to a file
+// after every change if it has one. Guilds without a roster of their own get
+// the characters the bae was started with.
+type partyStore struct {
+	path     string
+	defaults []string
+	mu       sync.Mutex
+	parties  map[string][]string
+}
+
+func newPartyStore(path string, defaults []string) (*partyStore, error) {
+	st := &partyStore{path: path, defaults: defaults, parties: make(map[string][]string)}
+	if path == "" {
+		return st, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read parties: %v", err)
+	}
+	if err := json.Unmarshal(b, &st.parties); err != nil {
+		return nil, fmt.Errorf("failed to parse parties %q: %v", path, err)
+	}
+	return st, nil
+}
+
+// get returns a copy of a guild's roster.
+func (st *partyStore) get(guildID string) []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return append([]string(nil), st.roster(guildID)...)
+}
+
+// roster returns a guild's roster. Callers must hold mu.
+func (st *partyStore) roster(guildID string) []string {
+	if p, ok := st.parties[guildID]; ok {
+		return p
+	}
+	return st.defaults
+}
+
+// all returns every key on any roster.
+func (st *partyStore) all() []string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	seen := make(map[string]bool)
+	var ret []string
+	for _, p := range append([][]string{st.defaults}, st.rosters()...) {
+		for _, k := range p {
+			if !seen[k] {
+				seen[k] = true
+				ret = append(ret, k)
+			}
+		}
+	}
+	return ret
+}
+
+// rosters returns every guild's own roster. Callers must hold mu.
+func (st *partyStore) rosters() [][]string {
+	var ret [][]string
+	for _, p := range st.parties {
+		ret = append(ret, p)
+	}
+	return ret
+}
+
+// update applies f to a guild's roster and saves the result.
+func (st *partyStore) update(guildID string, f func([]string) ([]string, error)) error {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	p, err := f(append([]string(nil), st.roster(guildID)...))
+	if err != nil {
+		return err
+	}
+	st.parties[guildID] = p
+	if st.path == "" {
+		return nil
+	}
+	b, err := json.MarshalIndent(st.parties, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal parties: %v", err)
+	}
+	return writeFileAtomic(st.path, b)
+}
+
+// inParty returns whether a character is on a guild's roster. Outside of a
+// guild, everyone is.
+func (ph *PlayerHandler) inParty(guildID string) func(key string) bool {
+	if guildID == "" {
+		return func(string) bool { return true }
+	}
+	party := make(map[string]bool)
+	for _, k := range ph.parties.get(guildID) {
+		party[k] = true
+	}
+	return func(key string) bool { return party[key] }
+}
+
+// PartyHandler returns a handler for "!party", which sums up everyone in the
+// party at once, "!party list", and for GMs, "!party add <D&D Beyond URL or
+// ID>" and "!party remove <character>".
+func (ph *PlayerHandler) PartyHandler() baepi.BaeSayHandler {
+	return &command{hotword: "party", say: ph.party}
+}
+
+func (ph *PlayerHandler) party(db baepi.DiceBae, e *baepi.Baevent, args []string) (*baepi.Baesponse, error) {
+	if e.GuildID == "" {
+		return say("Parties happen in servers, not DMs."), nil
+	}
+	if len(args) == 0 {
+		args = []string{"status"}
+	}
+	switch strings.ToLower(args[0]) {
+	case "status":
+		return say(ph.partyStatus(e.GuildID)), nil
+	case "list":
+		return say(ph.fmtParty(e.GuildID)), nil
+	case "add", "remove":
+		if !ph.isGM(e) {
+			return say(fmt.Sprintf("Only a %s can change the party.", ph.gmRole)), nil
+		}
+		if len(args) < 2 {
+			break
+		}
+		if strings.ToLower(args[0]) == "add" {
+			return ph.partyAdd(e, args[1])
+		}
+		return ph.partyRemove(e, strings.Join(args[1:], " "))
+	}
+	return say("Try !party, !party list, !party add <D&D Beyond URL or ID> or !party remove <character>."), nil
+}
+
+// isGM returns whether the speaker has the GM role.
+func (ph *PlayerHandler) isGM(e *baepi.Baevent) bool {
+	for _, r := range e.SpeakerRoles {
+		if strings.EqualFold(r, ph.gmRole) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ph *PlayerHandler) partyAdd(e *baepi.Baevent, spec string) (*baepi.Baesponse, error) {
+	src, err := ph.newSource(spec)
+	if err != nil {
+		return say(fmt.Sprintf("%q isn't a D&D Beyond character URL or ID.", spec)), nil
+	}
+	// Anything else would let anyone with the role read files off the bae.
+	if _, ok := src.(*dndBeyondSource); !ok {
+		return say("I can only add D&D Beyond characters on the fly."), nil
+	}
+	key := src.Key()
+	err = ph.parties.update(e.GuildID, func(p []string) ([]string, error) {
+		for _, k := range p {
+			if k == key {
+				return nil, errAlreadyInParty
+			}
+		}
+		return append(p, key), nil
+	})
+	if err == errAlreadyInParty {
+		return say("They're already in the party."), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	ph.addCharacter(src)
+	if err := ph.updateCharacterSheet(key, false); err != nil {
+		return say(fmt.Sprintf("Added %s, but I can't load their sheet yet. I'll keep trying.", key)), nil
+	}
+	name := key
+	ph.mu.Lock()
+	// They may have been removed again while loading.
+	if c := ph.characters[key]; c != nil && c.sheet != nil {
+		name = c.sheet.PlayerName
+	}
+	ph.mu.Unlock()
+	return say(fmt.Sprintf("Welcome to the party, %s!", name)), nil
+}
+
+// partyRemove removes a character named by their full name, an alias or their
+// key, so a typo can't kick out the wrong one.
+func (ph *PlayerHandler) partyRemove(e *baepi.Baevent, name string) (*baepi.Baesponse, error) {
+	key, cs, ambiguous := ph.find(e.GuildID, name, fullNames)
+	if len(ambiguous) > 0 {
+		return say(didYouMean(ambiguous)), nil
+	}
+	if key == "" {
+		// Characters that never loaded can be removed by key.
+		key = name
+	}
+	removed := false
+	err := ph.parties.update(e.GuildID, func(p []string) ([]string, error) {
+		var ret []string
+		for _, k := range p {
+			if k == key {
+				removed = true
+				continue
+			}
+			ret = append(ret, k)
+		}
+		return ret, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !removed {
+		return say(fmt.Sprintf("Who's %s?", name)), nil
+	}
+	ph.dropUnusedCharacters()
+	if cs != nil {
+		return say(fmt.Sprintf("So long, %s.", cs.PlayerName)), nil
+	}
+	return say(fmt.Sprintf("Removed %s.", key)), nil
+}
+
+// dropUnusedCharacters forgets characters that are no longer on any roster.
+func (ph *PlayerHandler) dropUnusedCharacters() {
+	used := make(map[string]bool)
+	for _, k := range ph.parties.all() {
+		used[k] = true
+	}
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	for k := range ph.characters {
+		if !used[k] {
+			delete(ph.characters, k)
+			ph.names.remove(k)
+		}
+	}
+}
+
+// fmtParty lists a guild's party, sorted by name.
+func (ph *PlayerHandler) fmtParty(guildID string) string {
+	keys := ph.parties.get(guildID)
+	if len(keys) == 0 {
+		return "The party's empty. A GM can !party add <D&D Beyond URL or ID>."
+	}
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	var names []string
+	for _, k := range keys {
+		if c := ph.characters[k]; c != nil && c.sheet != nil {
+			names = append(names, c.sheet.PlayerName)
+		} else {
+			names = append(names, k+" (still loading)")
+		}
+	}
+	sort.Strings(names)
+	return "**The party:** " + strings.Join(names, ", ")
+}
+
+// partyStatus formats a table of the party's HP, AC, passive Perception and
+// spell save DC, refreshing any stale sheets first. Sheets that couldn't be
+// refreshed are marked with an asterisk.
+func (ph *PlayerHandler) partyStatus(guildID string) string {
+	keys := ph.parties.get(guildID)
+	if len(keys) == 0 {
+		return "The party's empty. A GM can !party add <D&D Beyond URL or ID>."
+	}
+	failed := make([]bool, len(keys))
+	var wg sync.WaitGroup
+	for i, k := range keys {
+		wg.Add(1)
+		go func(i int, k string) {
+			defer wg.Done()
+			failed[i] = ph.updateCharacterSheet(k, false) != nil
+		}(i, k)
+	}
+	wg.Wait()
+
+	type row struct {
+		name  string
+		sheet *CharacterSheet
+		stale bool
+	}
+	var rows []row
+	var loading []string
+	ph.mu.Lock()
+	for i, k := range keys {
+		c := ph.characters[k]
+		if c == nil || c.sheet == nil {
+			loading = append(loading, k)
+			continue
+		}
+		rows = append(rows, row{c.sheet.PlayerName, c.sheet.withOverlay(ph.overlays.get(k)), failed[i]})
+	}
+	ph.mu.Unlock()
+	sort.Slice(rows, func(i, j int) bool { return rows[i].name < rows[j].name })
+
+	var b bytes.Buffer
+	tw := tabwriter.NewWriter(&b, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "Name\tHP\tAC\tPP\tDC")
+	anyStale := false
+	for _, r := range rows {
+		cs := r.sheet
+		name := r.name
+		if r.stale {
+			name += "*"
+			anyStale = true
+		}
+		hp := fmt.Sprintf("%d/%d", cs.CurrentHP, cs.TotalHP)
+		if cs.TempHP > 0 {
+			hp = fmt.Sprintf("%d+%d/%d", cs.CurrentHP, cs.TempHP, cs.TotalHP)
+		}
+		dc := "-"
+		if d := cs.SpellSaveDC(); d > 0 {
+			dc = fmt.Sprint(d)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\n", name, hp, cs.AC, cs.Passive("perception"), dc)
+	}
+	tw.Flush()
+
+	msg := "```\n" + b.String() + "```"
+	if anyStale {
+		msg += "\n*Couldn't refresh sheets marked with a \\*, so they may be out of date.*"
+	}
+	if len(loading) > 0 {
+		msg += fmt.Sprintf("\n*Still trying to load characters %s.*", strings.Join(loading, ", "))
+	}
+	return msg
+}
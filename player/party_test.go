@@ -0,0 +1,68 @@
+package player
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestPartyStoreUpdate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "party")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "parties.json")
+	st, err := newPartyStore(path, []string{"1", "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	add := func(key string) func([]string) ([]string, error) {
+		return func(p []string) ([]string, error) { return append(p, key), nil }
+	}
+	boom := errors.New("boom")
+
+	for _, tc := range []struct {
+		desc    string
+		guildID string
+		f       func([]string) ([]string, error)
+		wantErr error
+		want    []string
+	}{
+		{"starts from the defaults", "a", add("3"), nil, []string{"1", "2", "3"}},
+		{"keeps its own roster", "a", add("4"), nil, []string{"1", "2", "3", "4"}},
+		{"failures change nothing", "a", func([]string) ([]string, error) { return nil, boom }, boom, []string{"1", "2", "3", "4"}},
+		{"other guilds start over", "b", add("5"), nil, []string{"1", "2", "5"}},
+		{"can empty out", "c", func([]string) ([]string, error) { return nil, nil }, nil, nil},
+	} {
+		if err := st.update(tc.guildID, tc.f); err != tc.wantErr {
+			t.Errorf("%s: update() = %v, want %v", tc.desc, err, tc.wantErr)
+		}
+		if got := st.get(tc.guildID); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: got roster %v, want %v", tc.desc, got, tc.want)
+		}
+	}
+	if got := st.get("d"); !reflect.DeepEqual(got, []string{"1", "2"}) {
+		t.Errorf("got roster %v for a new guild, want the defaults", got)
+	}
+
+	// Rosters survive a restart, even with different defaults.
+	st, err = newPartyStore(path, []string{"9"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for guildID, want := range map[string][]string{"a": {"1", "2", "3", "4"}, "b": {"1", "2", "5"}, "c": nil, "d": {"9"}} {
+		if got := st.get(guildID); !reflect.DeepEqual(got, want) {
+			t.Errorf("got roster %v for %s after reloading, want %v", got, guildID, want)
+		}
+	}
+	got := st.all()
+	sort.Strings(got)
+	if want := []string{"1", "2", "3", "4", "5", "9"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("all() = %v, want %v in any order", got, want)
+	}
+}
@@ -2,90 +2,357 @@ package player
 
 import (
 	"fmt"
+	"math/rand"
 	"net/http"
+	"path"
+	"regexp"
 	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"dicebae/baepi"
 )
 
+var (
+	// Failed fetches are retried with exponential backoff between these bounds.
+	minRetryDelay = 5 * time.Second
+	maxRetryDelay = 30 * time.Minute
+	// How often the background refresher looks for sheets due a retry.
+	retryCheckInterval = 5 * time.Second
+)
+
+// PlayerArgs contains arguments for the creation of a PlayerHandler.
+type PlayerArgs struct {
+	// Characters lists where to load each character from. See newSource for
+	// the accepted forms.
+	Characters []string
+	// CacheDir is where fetched D&D Beyond characters are kept so the bae can
+	// start while D&D Beyond is unreachable. If empty, characters are only
+	// cached in memory.
+	CacheDir string
+	// CacheTTL is how long a fetched D&D Beyond character is used before asking
+	// for a newer one.
+	CacheTTL time.Duration
+	// GMRole is the Discord role allowed to change a server's party.
+	GMRole string
+	// Aliases maps nicknames to the names of the characters they stand for.
+	Aliases map[string]string
+	// StateDir is where the bae keeps what she tracks about characters herself,
+	// like spent spell slots and who plays whom. If empty, it's forgotten on restart.
+	StateDir string
+	// Announce, if set, is called with news about characters whose sheets
+	// changed when they were refreshed, like level-ups.
+	Announce func(msg string)
+}
+
 // PlayerHandler implements the BaeSayHandler interface for player character sheets.
 type PlayerHandler struct {
-	client           http.Client
-	playerIDs        []int
-	playerFirstNames []string
-	nameToID         map[string]int
-	charSheets       map[int]*CharacterSheet
+	ddb      *dndBeyond
+	overlays *overlayStore
+	bindings *bindingStore
+	parties  *partyStore
+	gmRole   string
+	announce func(msg string)
+
+	rngMu sync.Mutex
+	rng   *rand.Rand
+
+	mu         sync.Mutex
+	characters map[string]*character
+	names      *nameResolver
+}
+
+// character tracks the loading state of a single character sheet. A character
+// whose sheet failed to load keeps the last sheet that did, if any.
+type character struct {
+	source   CharacterSource
+	sheet    *CharacterSheet
+	lastSeen time.Time
+	lastErr  error
+	failures int
+	nextTry  time.Time
 }
 
-func NewPlayerHandler(playerIDs []int) *PlayerHandler {
+// NewPlayerHandler returns a handler for the given characters. Cached sheets
+// are available immediately; the rest are loaded in the background, and any
+// that fail are retried until they load.
+func NewPlayerHandler(args *PlayerArgs) (*PlayerHandler, error) {
+	cache, err := newSheetCache(args.CacheDir)
+	if err != nil {
+		return nil, err
+	}
+	var overlayPath, bindingPath, partyPath string
+	if args.StateDir != "" {
+		overlayPath = path.Join(args.StateDir, "overlays.json")
+		bindingPath = path.Join(args.StateDir, "bindings.json")
+		partyPath = path.Join(args.StateDir, "parties.json")
+	}
+	overlays, err := newOverlayStore(overlayPath)
+	if err != nil {
+		return nil, err
+	}
+	bindings, err := newBindingStore(bindingPath)
+	if err != nil {
+		return nil, err
+	}
+	gmRole := args.GMRole
+	if gmRole == "" {
+		gmRole = "GM"
+	}
 	ret := &PlayerHandler{
-		client: http.Client{
-			Timeout: 2 * time.Second,
+		ddb: &dndBeyond{
+			client: http.Client{
+				Timeout: 2 * time.Second,
+			},
+			cache:    cache,
+			cacheTTL: args.CacheTTL,
 		},
-		playerIDs:  playerIDs,
-		nameToID:   make(map[string]int),
-		charSheets: make(map[int]*CharacterSheet),
+		overlays:   overlays,
+		bindings:   bindings,
+		gmRole:     gmRole,
+		announce:   args.Announce,
+		rng:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		characters: make(map[string]*character),
+		names:      newNameResolver(args.Aliases),
 	}
-
-	for _, p := range ret.playerIDs {
-		pj, err := ret.fetchPlayerJSON(p)
+	var defaults []string
+	for _, spec := range args.Characters {
+		src, err := ret.newSource(spec)
 		if err != nil {
-			// FIXME: this should just return an error and proceed or retry.
-			panic("Failed to fetch player JSON:" + err.Error())
+			return nil, err
 		}
-		// Store the first name-part in lower case for easier matching. The
-		// character sheet will have the properly capitalized form.
-		// FIXME: This assumes characters have unique first names.
-		n := strings.Split(strings.ToLower(pj.Name), " ")[0]
-		ret.playerFirstNames = append(ret.playerFirstNames, n)
-		ret.nameToID[n] = pj.ID
-		ret.charSheets[pj.ID] = newCharacterSheet(pj)
+		defaults = append(defaults, src.Key())
 	}
-	sort.Strings(ret.playerFirstNames)
-	for _, n := range ret.playerFirstNames {
-		fmt.Printf("%s: %+v\n", n, ret.charSheets[ret.nameToID[n]])
+	if ret.parties, err = newPartyStore(partyPath, defaults); err != nil {
+		return nil, err
 	}
+	// Keys are specs too, so rosters saved by an earlier run load the same way.
+	for _, k := range ret.parties.all() {
+		src, err := ret.newSource(k)
+		if err != nil {
+			return nil, err
+		}
+		ret.addCharacter(src)
+		go ret.updateCharacterSheet(k, false)
+	}
+	go ret.retryFailedSheets()
+	return ret, nil
+}
 
-	return ret
+// addCharacter starts tracking a character, if it isn't already, with its
+// cached sheet if it has one. It's up to the caller to load it.
+func (ph *PlayerHandler) addCharacter(src CharacterSource) {
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	key := src.Key()
+	if ph.characters[key] != nil {
+		return
+	}
+	c := &character{source: src}
+	ph.characters[key] = c
+	if cs, seen := src.Cached(); cs != nil {
+		c.sheet = cs
+		c.lastSeen = seen
+		ph.names.add(cs.PlayerName, key)
+	}
 }
 
-func (ph *PlayerHandler) updateCharacterSheet(name string) error {
-	id := ph.nameToID[name]
-	js, err := ph.fetchPlayerJSON(id)
+// updateCharacterSheet loads the latest version of a character sheet,
+// recording the failure and scheduling a retry if that doesn't work out. Unless
+// forced, a recently loaded sheet may be reused.
+func (ph *PlayerHandler) updateCharacterSheet(key string, force bool) error {
+	ph.mu.Lock()
+	c := ph.characters[key]
+	ph.mu.Unlock()
+	if c == nil {
+		return fmt.Errorf("no character %q", key)
+	}
+	cs, err := c.source.Load(force)
+
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	if ph.characters[key] != c {
+		// Removed from the party while loading.
+		return fmt.Errorf("no character %q", key)
+	}
 	if err != nil {
+		c.lastErr = err
+		c.failures++
+		c.nextTry = time.Now().Add(retryDelay(c.failures))
+		fmt.Printf("Failed to load character %s (attempt %d, retrying at %s): %v\n",
+			key, c.failures, c.nextTry.Format(time.Kitchen), err)
 		return err
 	}
-	ph.charSheets[id] = newCharacterSheet(js)
+	old := c.sheet
+	renamed := old == nil || old.PlayerName != cs.PlayerName
+	c.sheet = cs
+	c.lastSeen = time.Now()
+	c.lastErr = nil
+	c.failures = 0
+	if renamed {
+		ph.names.add(cs.PlayerName, key)
+	}
+	if old != nil && ph.announce != nil {
+		if msg := announcement(old, cs); msg != "" {
+			// Don't make everyone waiting on mu wait on Discord too.
+			go ph.announce(msg)
+		}
+	}
 	return nil
 }
 
-func (ph *PlayerHandler) ShouldSay(db baepi.DiceBae, e *baepi.Baevent) bool {
-	if strings.HasPrefix(e.Message, "!who") {
-		for _, n := range ph.playerFirstNames {
-			if strings.Contains(strings.ToLower(e.Message), n) {
-				return true
+// retryFailedSheets runs forever, refetching sheets whose last fetch failed
+// once their backoff has passed.
+func (ph *PlayerHandler) retryFailedSheets() {
+	for range time.Tick(retryCheckInterval) {
+		now := time.Now()
+		var due []string
+		ph.mu.Lock()
+		for k, c := range ph.characters {
+			if c.lastErr != nil && !now.Before(c.nextTry) {
+				due = append(due, k)
 			}
 		}
+		ph.mu.Unlock()
+		for _, k := range due {
+			ph.updateCharacterSheet(k, true)
+		}
+	}
+}
+
+// retryDelay returns how long to wait after the given number of consecutive
+// failures, doubling each time up to maxRetryDelay.
+func retryDelay(failures int) time.Duration {
+	d := minRetryDelay
+	for i := 1; i < failures && d < maxRetryDelay; i++ {
+		d *= 2
+	}
+	if d > maxRetryDelay {
+		d = maxRetryDelay
+	}
+	return d
+}
+
+// unloaded returns the keys of characters in a guild's party that have never
+// loaded, sorted.
+func (ph *PlayerHandler) unloaded(guildID string) []string {
+	inParty := ph.inParty(guildID)
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	var ret []string
+	for k, c := range ph.characters {
+		if c.sheet == nil && inParty(k) {
+			ret = append(ret, k)
+		}
+	}
+	sort.Strings(ret)
+	return ret
+}
+
+var (
+	whoCommandRegexp = regexp.MustCompile(`^!(who|refresh)(\s|$)`)
+)
+
+func (ph *PlayerHandler) ShouldSay(db baepi.DiceBae, e *baepi.Baevent) bool {
+	if whoCommandRegexp.MatchString(e.Message) {
+		// Even if nobody is named, let them know if some sheets are missing.
+		keys, complaints := ph.whoKeys(e)
+		return len(keys) > 0 || len(complaints) > 0 || len(ph.unloaded(e.GuildID)) > 0
 	}
 	return false
 }
 
-func (ph *PlayerHandler) SayWithBae(db baepi.DiceBae, e *baepi.Baevent) (*baepi.Baesponse, error) {
-	var resps []string
-	for _, n := range ph.playerFirstNames {
-		if strings.Contains(e.Message, n) {
-			err := ph.updateCharacterSheet(n)
-			if err != nil {
-				resps = append(resps,
-					fmt.Sprintf("**failed to update character sheet for %s, using cached version**", n))
+// whoKeys returns the keys of the characters named in a !who, or the
+// speaker's own character if nobody is, and complaints about any names that
+// are ambiguous. Words that aren't names are ignored as long as some are.
+func (ph *PlayerHandler) whoKeys(e *baepi.Baevent) ([]string, []string) {
+	words := strings.Fields(e.Message)[1:]
+	if len(words) == 0 {
+		if k, cs := ph.boundSheet(e.GuildID, e.Speaker); cs != nil {
+			return []string{k}, nil
+		}
+		return nil, nil
+	}
+	inParty := ph.inParty(e.GuildID)
+	ph.mu.Lock()
+	defer ph.mu.Unlock()
+	if found := ph.names.resolve(strings.Join(words, " "), inParty, nearMisses); len(found) == 1 {
+		return []string{found[0].key}, nil
+	}
+	var keys, complaints, unknown []string
+	seen := make(map[string]bool)
+	for _, w := range words {
+		switch found := ph.names.resolve(w, inParty, nearMisses); len(found) {
+		case 0:
+			unknown = append(unknown, fmt.Sprintf("Who's %s?", w))
+		case 1:
+			if !seen[found[0].key] {
+				seen[found[0].key] = true
+				keys = append(keys, found[0].key)
+			}
+		default:
+			var names []string
+			for _, cn := range found {
+				names = append(names, cn.display)
 			}
-			cs := ph.charSheets[ph.nameToID[n]]
-			resps = append(resps, cs.String())
+			complaints = append(complaints, didYouMean(names))
+		}
+	}
+	if len(keys) == 0 && len(complaints) == 0 {
+		complaints = unknown
+	}
+	return keys, complaints
+}
+
+// SayWithBae shows the sheets of the characters named in a !who, or the
+// speaker's own, refetching any that are stale. A !refresh refetches them
+// regardless.
+func (ph *PlayerHandler) SayWithBae(db baepi.DiceBae, e *baepi.Baevent) (*baepi.Baesponse, error) {
+	force := strings.HasPrefix(e.Message, "!refresh")
+	keys, resps := ph.whoKeys(e)
+	for _, k := range keys {
+		err := ph.updateCharacterSheet(k, force)
+
+		ph.mu.Lock()
+		c := ph.characters[k]
+		if c == nil {
+			// Removed from the party while loading.
+			resps = append(resps, fmt.Sprintf("*%s isn't in the party anymore.*", k))
+			ph.mu.Unlock()
+			continue
+		}
+		if c.sheet == nil {
+			// Still loading, which the note below covers.
+			ph.mu.Unlock()
+			continue
+		}
+		if err != nil {
+			db.LogError("failed to update character sheet for %s: %v", k, err)
+			resps = append(resps, fmt.Sprintf("**%s's sheet is unavailable, last seen %s.** Here's what I remember:",
+				c.sheet.PlayerName, fmtAgo(time.Since(c.lastSeen))))
 		}
+		resps = append(resps, c.sheet.withOverlay(ph.overlays.get(k)).String())
+		ph.mu.Unlock()
+	}
+	if keys := ph.unloaded(e.GuildID); len(keys) > 0 {
+		resps = append(resps, fmt.Sprintf("*Still trying to load characters %s.*", strings.Join(keys, ", ")))
 	}
 	return &baepi.Baesponse{
 		Message: strings.Join(resps, "\n"),
 	}, nil
 }
+
+// fmtAgo formats an elapsed duration the way a person would say it.
+func fmtAgo(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return fmt.Sprintf("%dm ago", int(d.Minutes()))
+	case d < 24*time.Hour:
+		return fmt.Sprintf("%dh ago", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(d.Hours()/24))
+	}
+}
@@ -0,0 +1,216 @@
+package player
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"dicebae/baepi"
+)
+
+// RestHandler returns a handler for "!rest short [character] [hit dice]",
+// which spends hit dice to heal, and "!rest long [character|party]", which
+// restores HP, half the character's hit dice, spell slots and features.
+func (ph *PlayerHandler) RestHandler() baepi.BaeSayHandler {
+	return &command{hotword: "rest", say: ph.rest}
+}
+
+func (ph *PlayerHandler) rest(db baepi.DiceBae, e *baepi.Baevent, args []string) (*baepi.Baesponse, error) {
+	if len(args) > 0 {
+		switch strings.ToLower(args[0]) {
+		case "short":
+			return ph.shortRest(e, args[1:])
+		case "long":
+			if len(args) == 2 && strings.ToLower(args[1]) == "party" && e.GuildID != "" {
+				return ph.partyLongRest(e.GuildID)
+			}
+			return ph.longRest(e, args[1:])
+		}
+	}
+	return say("Try !rest short [character] [hit dice] or !rest long [character|party]."), nil
+}
+
+func (ph *PlayerHandler) shortRest(e *baepi.Baevent, args []string) (*baepi.Baesponse, error) {
+	key, cs, args, missing := ph.whose(e, args)
+	if missing != nil {
+		return missing, nil
+	}
+	spend := 0
+	if len(args) > 0 {
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n < 0 {
+			return say(fmt.Sprintf("%q isn't a number of hit dice.", args[0])), nil
+		}
+		spend = n
+	}
+	var msg string
+	err := ph.overlays.update(key, func(o *overlay) error {
+		if o.dead() {
+			return fmt.Errorf("%s is dead, that's a very long rest", cs.PlayerName)
+		}
+		o.PactUsed = 0
+		for _, f := range cs.Features {
+			if f.ShortRest {
+				delete(o.FeaturesUsed, strings.ToLower(f.Name))
+			}
+		}
+		msg = fmt.Sprintf("%s takes a short rest.", cs.PlayerName)
+		if spend > 0 {
+			healed, rolled, spent := ph.spendHitDice(cs, o, spend)
+			if spent == 0 {
+				return fmt.Errorf("%s is out of hit dice", cs.PlayerName)
+			}
+			drama, err := o.heal(cs, healed)
+			if err != nil {
+				return err
+			}
+			msg = fmt.Sprintf("%s takes a short rest, spending %d hit %s to heal %d (%s), now at %s.%s",
+				cs.PlayerName, spent, pluralDice(spent), healed, rolled, fmtHP(cs, o), drama)
+		}
+		msg += " " + cs.fmtHitDice(*o)
+		return nil
+	})
+	if err != nil {
+		return say(err.Error() + "."), nil
+	}
+	return say(msg), nil
+}
+
+// spendHitDice rolls up to n of the character's remaining hit dice, biggest
+// first, adding their Con modifier to each. It returns the HP healed, the
+// rolls, and how many dice it spent.
+func (ph *PlayerHandler) spendHitDice(cs *CharacterSheet, o *overlay, n int) (int, string, int) {
+	con := cs.Mod("con")
+	total, spent := 0, 0
+	var rolls []string
+	ph.rngMu.Lock()
+	defer ph.rngMu.Unlock()
+	for _, size := range hitDieSizes(cs) {
+		for ; spent < n && o.HitDiceUsed[size] < cs.HitDice()[size]; spent++ {
+			o.HitDiceUsed[size]++
+			r := ph.rng.Intn(size) + 1
+			if r+con > 0 {
+				total += r + con
+			}
+			rolls = append(rolls, fmt.Sprintf("d%d: %d", size, r))
+		}
+	}
+	if spent == 0 {
+		return 0, "", 0
+	}
+	return total, fmt.Sprintf("%s, %+d Con each", strings.Join(rolls, ", "), con), spent
+}
+
+// hitDieSizes returns the sizes of the character's hit dice, biggest first.
+func hitDieSizes(cs *CharacterSheet) []int {
+	var sizes []int
+	for size := range cs.HitDice() {
+		sizes = append(sizes, size)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(sizes)))
+	return sizes
+}
+
+// fmtHitDice formats the character's remaining hit dice.
+func (cs *CharacterSheet) fmtHitDice(o overlay) string {
+	hd := cs.HitDice()
+	var ss []string
+	for _, size := range hitDieSizes(cs) {
+		ss = append(ss, fmt.Sprintf("%d/%dd%d", hd[size]-o.HitDiceUsed[size], hd[size], size))
+	}
+	if len(ss) == 0 {
+		return "No idea what their hit dice are."
+	}
+	return "Hit dice left: " + strings.Join(ss, ", ") + "."
+}
+
+func pluralDice(n int) string {
+	if n == 1 {
+		return "die"
+	}
+	return "dice"
+}
+
+func (ph *PlayerHandler) longRest(e *baepi.Baevent, args []string) (*baepi.Baesponse, error) {
+	key, cs, _, missing := ph.whose(e, args)
+	if missing != nil {
+		return missing, nil
+	}
+	var msg string
+	err := ph.overlays.update(key, func(o *overlay) error {
+		var err error
+		msg, err = o.longRest(cs)
+		return err
+	})
+	if err != nil {
+		return say(err.Error() + "."), nil
+	}
+	return say(msg), nil
+}
+
+// partyLongRest has everyone in a guild's party take a long rest.
+func (ph *PlayerHandler) partyLongRest(guildID string) (*baepi.Baesponse, error) {
+	type member struct {
+		key   string
+		sheet *CharacterSheet
+	}
+	var members []member
+	ph.mu.Lock()
+	for _, k := range ph.parties.get(guildID) {
+		if c := ph.characters[k]; c != nil && c.sheet != nil {
+			members = append(members, member{k, c.sheet})
+		}
+	}
+	ph.mu.Unlock()
+	if len(members) == 0 {
+		return say("There's nobody in the party to rest."), nil
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].sheet.PlayerName < members[j].sheet.PlayerName })
+
+	var lines []string
+	for _, m := range members {
+		err := ph.overlays.update(m.key, func(o *overlay) error {
+			msg, err := o.longRest(m.sheet)
+			if err != nil {
+				return err
+			}
+			lines = append(lines, msg)
+			return nil
+		})
+		if err != nil {
+			lines = append(lines, err.Error()+".")
+		}
+	}
+	return say("The party takes a long rest.\n" + strings.Join(lines, "\n")), nil
+}
+
+// longRest restores the character's HP, spell slots and features, and half
+// their hit dice, takes off a level of exhaustion, and describes the result.
+func (o *overlay) longRest(cs *CharacterSheet) (string, error) {
+	if o.dead() {
+		return "", fmt.Errorf("%s is dead, that's a very long rest", cs.PlayerName)
+	}
+	if o.Conditions[exhaustion] > 1 {
+		o.Conditions[exhaustion]--
+	} else {
+		delete(o.Conditions, exhaustion)
+	}
+	o.setHP(o.maxHP(cs))
+	o.TempHP = 0
+	o.DeathSaves = deathSaves{}
+	o.SlotsUsed = [9]int{}
+	o.PactUsed = 0
+	o.FeaturesUsed = make(map[string]int)
+
+	regain := cs.Level / 2
+	if regain < 1 {
+		regain = 1
+	}
+	for _, size := range hitDieSizes(cs) {
+		for ; regain > 0 && o.HitDiceUsed[size] > 0; regain-- {
+			o.HitDiceUsed[size]--
+		}
+	}
+	return fmt.Sprintf("%s finishes a long rest at %s. %s", cs.PlayerName, fmtHP(cs, o), cs.fmtHitDice(*o)), nil
+}
@@ -0,0 +1,201 @@
+package player
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Proficiency is how well a character knows a skill.
+type Proficiency int
+
+const (
+	NotProficient Proficiency = iota
+	HalfProficient
+	Proficient
+	Expertise
+)
+
+var (
+	// skillAbilities maps each skill, as D&D Beyond names it, to the ability it
+	// is rolled with.
+	skillAbilities = map[string]string{
+		"acrobatics":      "dex",
+		"animal-handling": "wis",
+		"arcana":          "int",
+		"athletics":       "str",
+		"deception":       "cha",
+		"history":         "int",
+		"insight":         "wis",
+		"intimidation":    "cha",
+		"investigation":   "int",
+		"medicine":        "wis",
+		"nature":          "int",
+		"perception":      "wis",
+		"performance":     "cha",
+		"persuasion":      "cha",
+		"religion":        "int",
+		"sleight-of-hand": "dex",
+		"stealth":         "dex",
+		"survival":        "wis",
+	}
+	abilityNames = map[string]string{
+		"str": "Strength",
+		"dex": "Dexterity",
+		"con": "Constitution",
+		"int": "Intelligence",
+		"wis": "Wisdom",
+		"cha": "Charisma",
+	}
+)
+
+// ProficiencyBonus returns the character's proficiency bonus for their level.
+func (cs *CharacterSheet) ProficiencyBonus() int {
+	if cs.Level < 1 {
+		return 2
+	}
+	return 2 + (cs.Level-1)/4
+}
+
+// Score returns the character's score for an ability, e.g., "str".
+func (cs *CharacterSheet) Score(ability string) int {
+	switch ability {
+	case "str":
+		return cs.Str
+	case "dex":
+		return cs.Dex
+	case "con":
+		return cs.Con
+	case "int":
+		return cs.Int
+	case "wis":
+		return cs.Wis
+	case "cha":
+		return cs.Cha
+	}
+	return 10
+}
+
+// Mod returns the character's modifier for an ability, e.g., "str".
+func (cs *CharacterSheet) Mod(ability string) int {
+	return statMod(cs.Score(ability))
+}
+
+// SkillBonus returns the bonus the character adds to checks with a skill.
+func (cs *CharacterSheet) SkillBonus(skill string) int {
+	return cs.Mod(skillAbilities[skill]) + cs.proficiencyFor(cs.Skills[skill]) + cs.CheckBonus
+}
+
+// AbilityCheckBonus returns the bonus the character adds to a raw ability
+// check, which gets Jack of All Trades but no other proficiency.
+func (cs *CharacterSheet) AbilityCheckBonus(ability string) int {
+	return cs.Mod(ability) + cs.proficiencyFor(NotProficient) + cs.CheckBonus
+}
+
+// SaveBonus returns the bonus the character adds to saving throws for an
+// ability.
+func (cs *CharacterSheet) SaveBonus(ability string) int {
+	b := cs.Mod(ability) + cs.SaveBonuses[ability] + cs.SaveBonuses["all"]
+	if cs.SaveProficiencies[ability] {
+		b += cs.ProficiencyBonus()
+	}
+	return b
+}
+
+// proficiencyFor returns what a given level of proficiency adds to a roll.
+// Anything the character isn't proficient in gets Jack of All Trades, if they
+// have it.
+func (cs *CharacterSheet) proficiencyFor(p Proficiency) int {
+	if p == NotProficient && cs.JackOfAllTrades {
+		p = HalfProficient
+	}
+	switch p {
+	case HalfProficient:
+		return cs.ProficiencyBonus() / 2
+	case Proficient:
+		return cs.ProficiencyBonus()
+	case Expertise:
+		return 2 * cs.ProficiencyBonus()
+	}
+	return 0
+}
+
+// addProficiency records proficiency in a skill, keeping the better of what
+// the character already had.
+func (cs *CharacterSheet) addProficiency(skill string, p Proficiency) {
+	if _, ok := skillAbilities[skill]; !ok {
+		return
+	}
+	if cs.Skills == nil {
+		cs.Skills = make(map[string]Proficiency)
+	}
+	if p > cs.Skills[skill] {
+		cs.Skills[skill] = p
+	}
+}
+
+func (cs *CharacterSheet) addSaveProficiency(ability string) {
+	if _, ok := abilityNames[ability]; !ok {
+		return
+	}
+	if cs.SaveProficiencies == nil {
+		cs.SaveProficiencies = make(map[string]bool)
+	}
+	cs.SaveProficiencies[ability] = true
+}
+
+func (cs *CharacterSheet) addSaveBonus(ability string, bonus int) {
+	if _, ok := abilityNames[ability]; !ok && ability != "all" {
+		return
+	}
+	if cs.SaveBonuses == nil {
+		cs.SaveBonuses = make(map[string]int)
+	}
+	cs.SaveBonuses[ability] += bonus
+}
+
+// abilityKey returns the three letter key of an ability given its full name or
+// abbreviation, in any case, or "" if it isn't one.
+func abilityKey(name string) string {
+	name = strings.ToLower(name)
+	for k, n := range abilityNames {
+		if name == k || name == strings.ToLower(n) {
+			return k
+		}
+	}
+	return ""
+}
+
+// findSkill returns the skill named by the given words, allowing any unique
+// prefix, e.g., "sleight of hand", "sleight" or "perc".
+func findSkill(words []string) (string, error) {
+	name := strings.ToLower(strings.Join(words, "-"))
+	if _, ok := skillAbilities[name]; ok {
+		return name, nil
+	}
+	var found []string
+	for s := range skillAbilities {
+		if strings.HasPrefix(s, name) {
+			found = append(found, s)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return "", fmt.Errorf("%q isn't a skill", strings.Join(words, " "))
+	case 1:
+		return found[0], nil
+	}
+	sort.Strings(found)
+	return "", fmt.Errorf("%q could be %s", strings.Join(words, " "), strings.Join(found, " or "))
+}
+
+// skillTitle returns a skill's name as printed in the Player's Handbook.
+func skillTitle(skill string) string {
+	words := strings.Split(skill, "-")
+	for i, w := range words {
+		if w != "of" {
+			words[i] = strings.ToUpper(w[:1]) + w[1:]
+		}
+	}
+	return strings.Join(words, " ")
+}
@@ -0,0 +1,95 @@
+package player
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	// Matches a bare D&D Beyond character ID or a character sheet URL.
+	dndBeyondRegexp = regexp.MustCompile(`^(?:https?://(?:www\.)?dndbeyond\.com/(?:profile/[^/]+/)?characters?/)?(\d+)(?:[/?#].*)?$`)
+)
+
+// CharacterSource loads a character sheet from wherever the character lives.
+type CharacterSource interface {
+	// Key stably and uniquely identifies the character, e.g., "dndbeyond:1234".
+	Key() string
+	// Load returns the character's current sheet. Unless forced, sources may
+	// return a recently loaded sheet rather than going back to the source.
+	Load(force bool) (*CharacterSheet, error)
+	// Cached returns the last sheet loaded in an earlier run, and when it was
+	// loaded, or nil if there is none.
+	Cached() (*CharacterSheet, time.Time)
+}
+
+// newSource parses a character source spec. Specs are one of:
+//
+//	1234 or https://www.dndbeyond.com/characters/1234  a D&D Beyond character
+//	file:path/to/sheet.yaml                           a local JSON or YAML sheet
+//	foundry:path/to/actor.json                        a Foundry VTT actor export
+func (ph *PlayerHandler) newSource(spec string) (CharacterSource, error) {
+	spec = strings.TrimSpace(spec)
+	kind, arg := "dndbeyond", spec
+	if i := strings.Index(spec, ":"); i >= 0 && !strings.HasPrefix(spec, "http") {
+		kind, arg = strings.ToLower(spec[:i]), spec[i+1:]
+	}
+	switch kind {
+	case "dndbeyond", "ddb":
+		sub := dndBeyondRegexp.FindStringSubmatch(arg)
+		if sub == nil {
+			return nil, fmt.Errorf("%q isn't a D&D Beyond character ID or URL", arg)
+		}
+		id, err := strconv.Atoi(sub[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid D&D Beyond character ID %q: %v", sub[1], err)
+		}
+		return &dndBeyondSource{ddb: ph.ddb, id: id}, nil
+	case "file":
+		return &fileSource{path: arg}, nil
+	case "foundry":
+		return &foundrySource{path: arg}, nil
+	default:
+		return nil, fmt.Errorf("unknown character source %q in %q", kind, spec)
+	}
+}
+
+// dndBeyond holds what's shared by every D&D Beyond character.
+type dndBeyond struct {
+	client   http.Client
+	cache    *sheetCache
+	cacheTTL time.Duration
+}
+
+// dndBeyondSource loads a character from D&D Beyond.
+type dndBeyondSource struct {
+	ddb *dndBeyond
+	id  int
+}
+
+func (s *dndBeyondSource) Key() string {
+	return fmt.Sprintf("dndbeyond:%d", s.id)
+}
+
+func (s *dndBeyondSource) Load(force bool) (*CharacterSheet, error) {
+	js, err := s.ddb.fetchPlayerJSON(s.id, force)
+	if err != nil {
+		return nil, err
+	}
+	return newCharacterSheet(js), nil
+}
+
+func (s *dndBeyondSource) Cached() (*CharacterSheet, time.Time) {
+	cj := s.ddb.cache.get(s.id)
+	if cj == nil {
+		return nil, time.Time{}
+	}
+	js, err := decodePlayerJSON(cj.Body)
+	if err != nil {
+		return nil, time.Time{}
+	}
+	return newCharacterSheet(js), cj.FetchedAt
+}
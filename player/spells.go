@@ -0,0 +1,214 @@
+package player
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"dicebae/roll"
+)
+
+// Spell is a spell a character can cast.
+type Spell struct {
+	Name  string
+	Level int
+	// Damage is the spell's damage dice when cast at its own level, if any.
+	Damage     string
+	DamageType string
+	// ScaleType and Scaling describe what the spell gains at higher levels. See
+	// SpellDefinition and HigherLevelDefinition.
+	ScaleType string
+	Scaling   []SpellScaling
+}
+
+// SpellScaling is extra damage dice a spell gains at a higher level.
+type SpellScaling struct {
+	Level int
+	Dice  string
+}
+
+// newSpell builds a spell from its D&D Beyond definition.
+func newSpell(d *SpellDefinition) *Spell {
+	sp := &Spell{Name: d.Name, Level: d.Level, ScaleType: d.ScaleType}
+	for _, m := range d.Modifiers {
+		if m.Type != "damage" || m.Die == nil || m.Die.DiceString == "" {
+			continue
+		}
+		sp.Damage, sp.DamageType = m.Die.DiceString, m.SubType
+		for _, hl := range m.AtHigherLevels.HigherLevelDefinitions {
+			if hl.Dice != nil && hl.Dice.DiceString != "" {
+				sp.Scaling = append(sp.Scaling, SpellScaling{Level: hl.Level, Dice: hl.Dice.DiceString})
+			}
+		}
+		break
+	}
+	return sp
+}
+
+// damageAt returns the damage dice of a spell cast with a slot of the given
+// level by a character of the given level.
+func (sp *Spell) damageAt(slot, charLevel int) ([]*roll.RollRequest, error) {
+	base := sp.Damage
+	var extra []*roll.RollRequest
+	switch sp.ScaleType {
+	case "characterlevel":
+		// Cantrips replace their dice at certain character levels.
+		for _, sc := range sp.Scaling {
+			if sc.Level <= charLevel {
+				base = sc.Dice
+			}
+		}
+	case "spellscale":
+		// Spells gain dice for every so many slot levels above their own.
+		if len(sp.Scaling) > 0 && sp.Scaling[0].Level > 0 && slot > sp.Level {
+			n := (slot - sp.Level) / sp.Scaling[0].Level
+			for i := 0; i < n; i++ {
+				reqs, err := roll.ParseRollRequests(sp.Scaling[0].Dice)
+				if err != nil {
+					return nil, err
+				}
+				extra = append(extra, reqs...)
+			}
+		}
+	}
+	reqs, err := roll.ParseRollRequests(base)
+	if err != nil {
+		return nil, err
+	}
+	// Fold extra dice into matching base dice, so 8d6 plus 1d6 reads as 9d6.
+	for _, x := range extra {
+		merged := false
+		for _, r := range reqs {
+			if r.Die == x.Die {
+				r.Multiplier += x.Multiplier
+				r.Modifier += x.Modifier
+				merged = true
+				break
+			}
+		}
+		if !merged {
+			reqs = append(reqs, x)
+		}
+	}
+	return reqs, nil
+}
+
+// setSpells collects every spell the character has from any source.
+func (cs *CharacterSheet) setSpells(p *DNDBeyondJSON) {
+	seen := make(map[string]bool)
+	add := func(css []CharacterSpell) {
+		for i := range css {
+			d := &css[i].Definition
+			if d.Name == "" || seen[d.Name] {
+				continue
+			}
+			seen[d.Name] = true
+			cs.Spells = append(cs.Spells, newSpell(d))
+		}
+	}
+	for _, cls := range p.ClassSpells {
+		add(cls.Spells)
+	}
+	for _, css := range [][]CharacterSpell{p.Spells.Race, p.Spells.Class, p.Spells.Item, p.Spells.Feat} {
+		add(css)
+	}
+	sort.Slice(cs.Spells, func(i, j int) bool {
+		if cs.Spells[i].Level != cs.Spells[j].Level {
+			return cs.Spells[i].Level < cs.Spells[j].Level
+		}
+		return cs.Spells[i].Name < cs.Spells[j].Name
+	})
+}
+
+// setSpellSlots works out the character's spell slots and pact magic from
+// their classes' spell rules, combining casting classes by the multiclass
+// table, and falls back to what D&D Beyond reports.
+func (cs *CharacterSheet) setSpellSlots(p *DNDBeyondJSON) {
+	var casters []*PlayerClass
+	known := false
+	for i := range p.Classes {
+		pc := &p.Classes[i]
+		rules := pc.Definition.SpellRules
+		if rules == nil || pc.Level >= len(rules.LevelSpellSlots) {
+			continue
+		}
+		known = true
+		if pc.Definition.Name == "Warlock" {
+			row := rules.LevelSpellSlots[pc.Level]
+			for i := 0; i < len(row) && i < len(cs.SpellSlots); i++ {
+				if row[i] > 0 {
+					cs.PactSlots, cs.PactSlotLevel = row[i], i+1
+				}
+			}
+		} else if casterLevel(pc) > 0 {
+			casters = append(casters, pc)
+		}
+	}
+	switch {
+	case len(casters) == 1:
+		// Single-class casters have their own table, which rounds in their favor.
+		pc := casters[0]
+		copy(cs.SpellSlots[:], pc.Definition.SpellRules.LevelSpellSlots[pc.Level])
+	case len(casters) > 1:
+		lvl := 0
+		for _, pc := range casters {
+			lvl += casterLevel(pc)
+		}
+		if lvl >= len(multiclassSpellSlots) {
+			lvl = len(multiclassSpellSlots) - 1
+		}
+		cs.SpellSlots = multiclassSpellSlots[lvl]
+	}
+	if known {
+		return
+	}
+	for _, ss := range p.SpellSlots {
+		if ss.Level >= 1 && ss.Level <= len(cs.SpellSlots) {
+			cs.SpellSlots[ss.Level-1] = ss.Available
+		}
+	}
+	for _, ss := range p.PactMagic {
+		if ss.Available > 0 {
+			cs.PactSlots, cs.PactSlotLevel = ss.Available, ss.Level
+		}
+	}
+}
+
+// findSpell returns the character's spell best matching name.
+func (cs *CharacterSheet) findSpell(name string) (*Spell, error) {
+	name = strings.ToLower(name)
+	var found []*Spell
+	for _, sp := range cs.Spells {
+		n := strings.ToLower(sp.Name)
+		if n == name {
+			return sp, nil
+		}
+		if strings.HasPrefix(n, name) {
+			found = append(found, sp)
+		}
+	}
+	switch len(found) {
+	case 0:
+		return nil, fmt.Errorf("%s doesn't know %s", cs.PlayerName, name)
+	case 1:
+		return found[0], nil
+	}
+	var names []string
+	for _, sp := range found {
+		names = append(names, sp.Name)
+	}
+	return nil, fmt.Errorf("%q could be %s", name, strings.Join(names, " or "))
+}
+
+// ordinal formats a spell level like "3rd".
+func ordinal(n int) string {
+	switch n {
+	case 1:
+		return "1st"
+	case 2:
+		return "2nd"
+	case 3:
+		return "3rd"
+	}
+	return fmt.Sprintf("%dth", n)
+}
@@ -0,0 +1,147 @@
+package player
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Weapon is a weapon a character can attack with.
+type Weapon struct {
+	Name       string
+	Damage     string // Damage dice, e.g., 1d8.
+	DamageType string
+	// Versatile holds the two-handed damage dice of versatile weapons.
+	Versatile  string
+	Finesse    bool
+	Ranged     bool
+	Proficient bool
+	// Magic is the weapon's bonus to attack and damage rolls, e.g., 1 for a +1
+	// longsword.
+	Magic int
+	Extra []ExtraDamage
+}
+
+// ExtraDamage is damage a weapon deals on top of its regular damage, e.g.,
+// the 2d6 fire of a flame tongue.
+type ExtraDamage struct {
+	Dice string
+	Type string
+}
+
+// AttackAbility returns the ability the character attacks with using w.
+func (cs *CharacterSheet) AttackAbility(w *Weapon) string {
+	ab := "str"
+	if w.Ranged {
+		ab = "dex"
+	}
+	if w.Finesse && cs.Dex > cs.Str {
+		ab = "dex"
+	}
+	return ab
+}
+
+// AttackBonus returns the character's bonus to hit with w.
+func (cs *CharacterSheet) AttackBonus(w *Weapon) int {
+	b := cs.Mod(cs.AttackAbility(w)) + w.Magic + cs.AttackBonuses["all"]
+	if w.Proficient {
+		b += cs.ProficiencyBonus()
+	}
+	if w.Ranged {
+		b += cs.AttackBonuses["ranged"]
+	} else {
+		b += cs.AttackBonuses["melee"]
+	}
+	return b
+}
+
+// DamageBonus returns what the character adds to damage rolls with w.
+func (cs *CharacterSheet) DamageBonus(w *Weapon) int {
+	return cs.Mod(cs.AttackAbility(w)) + w.Magic
+}
+
+// findWeapon returns the character's weapon best matching name, preferring
+// exact names over prefixes over substrings.
+func (cs *CharacterSheet) findWeapon(name string) (*Weapon, error) {
+	name = strings.ToLower(name)
+	var prefixed, contained []*Weapon
+	for _, w := range cs.Weapons {
+		n := strings.ToLower(w.Name)
+		switch {
+		case n == name:
+			return w, nil
+		case strings.HasPrefix(n, name):
+			prefixed = append(prefixed, w)
+		case strings.Contains(n, name):
+			contained = append(contained, w)
+		}
+	}
+	for _, ws := range [][]*Weapon{prefixed, contained} {
+		switch len(ws) {
+		case 0:
+			continue
+		case 1:
+			return ws[0], nil
+		}
+		var names []string
+		for _, w := range ws {
+			names = append(names, w.Name)
+		}
+		return nil, fmt.Errorf("%q could be %s", name, strings.Join(names, " or "))
+	}
+	return nil, fmt.Errorf("%s doesn't have a %s", cs.PlayerName, name)
+}
+
+// newWeapon builds a weapon from a D&D Beyond inventory item, or returns nil if
+// the item isn't a weapon.
+func (cs *CharacterSheet) newWeapon(it *InventoryItem) *Weapon {
+	d := &it.Definition
+	if d.FilterType != "Weapon" || d.Damage == nil {
+		return nil
+	}
+	w := &Weapon{
+		Name:       d.Name,
+		Damage:     d.Damage.DiceString,
+		DamageType: d.DamageType,
+		Ranged:     d.AttackType == 2,
+	}
+	for _, p := range d.Properties {
+		switch p.Name {
+		case "Finesse":
+			w.Finesse = true
+		case "Versatile":
+			w.Versatile = p.Notes
+		}
+	}
+	for _, m := range d.GrantedModifiers {
+		if m.RequiresAttunement && !it.IsAttuned {
+			continue
+		}
+		switch {
+		case m.Type == "bonus" && m.SubType == "magic":
+			w.Magic += m.Value
+		case m.Type == "damage" && m.Dice != nil && m.Dice.DiceString != "":
+			w.Extra = append(w.Extra, ExtraDamage{Dice: m.Dice.DiceString, Type: m.SubType})
+		}
+	}
+	category := map[int]string{1: "simple-weapons", 2: "martial-weapons"}[d.CategoryID]
+	w.Proficient = cs.OtherProficiencies[category] || cs.OtherProficiencies[skillKey(d.Type)]
+	return w
+}
+
+func (cs *CharacterSheet) addAttackBonus(kind string, bonus int) {
+	if cs.AttackBonuses == nil {
+		cs.AttackBonuses = make(map[string]int)
+	}
+	cs.AttackBonuses[kind] += bonus
+}
+
+// addOtherProficiency records a proficiency that isn't in a skill or save.
+func (cs *CharacterSheet) addOtherProficiency(kind string) {
+	if _, ok := skillAbilities[kind]; ok || strings.HasSuffix(kind, "-saving-throws") {
+		return
+	}
+	if cs.OtherProficiencies == nil {
+		cs.OtherProficiencies = make(map[string]bool)
+	}
+	cs.OtherProficiencies[kind] = true
+}
@@ -0,0 +1,376 @@
+package player
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// yamlToJSON converts the YAML people write character sheets in to JSON, so
+// sheets can be decoded like any other. It only knows the parts of YAML that
+// sheets need: nested maps and lists, both as blocks and as [flow, lists] and
+// {flow: maps}, quoted and plain scalars, and comments. Anchors, tags,
+// multi-line strings and multiple documents are beyond it.
+func yamlToJSON(b []byte) ([]byte, error) {
+	lines, err := yamlLines(string(b))
+	if err != nil {
+		return nil, err
+	}
+	p := &yamlParser{lines: lines}
+	var v interface{}
+	if len(lines) > 0 {
+		if v, err = p.block(lines[0].indent); err != nil {
+			return nil, err
+		}
+	}
+	if p.i < len(p.lines) {
+		return nil, p.errorf("unexpected indentation")
+	}
+	return json.Marshal(v)
+}
+
+// yamlLine is a line of YAML with its indentation and comment stripped.
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+// yamlLines splits YAML into lines worth parsing, leaving out blank lines,
+// comments and document markers.
+func yamlLines(s string) ([]*yamlLine, error) {
+	var ret []*yamlLine
+	for i, l := range strings.Split(s, "\n") {
+		l = strings.TrimRight(stripYAMLComment(l), " \t\r")
+		text := strings.TrimLeft(l, " ")
+		if text == "" || text == "---" {
+			continue
+		}
+		if strings.HasPrefix(text, "\t") {
+			return nil, fmt.Errorf("line %d: YAML can't be indented with tabs", i+1)
+		}
+		if text == "..." {
+			return nil, fmt.Errorf("line %d: only one document per character sheet", i+1)
+		}
+		ret = append(ret, &yamlLine{num: i + 1, indent: len(l) - len(text), text: text})
+	}
+	return ret, nil
+}
+
+// stripYAMLComment removes a # comment from a line, unless it's quoted or
+// part of a word, like "C#".
+func stripYAMLComment(l string) string {
+	var quote rune
+	for i, r := range l {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		// Quotes only start strings at the start of a value, so apostrophes
+		// like in "Grandmother's Spectacles" don't.
+		case (r == '"' || r == '\'') && (i == 0 || strings.IndexByte(" [{,", l[i-1]) >= 0):
+			quote = r
+		case r == '#' && (i == 0 || l[i-1] == ' ' || l[i-1] == '\t'):
+			return l[:i]
+		}
+	}
+	return l
+}
+
+type yamlParser struct {
+	lines []*yamlLine
+	i     int
+}
+
+func (p *yamlParser) errorf(format string, args ...interface{}) error {
+	num := 0
+	if p.i < len(p.lines) {
+		num = p.lines[p.i].num
+	} else if len(p.lines) > 0 {
+		num = p.lines[len(p.lines)-1].num
+	}
+	return fmt.Errorf("line %d: %s", num, fmt.Sprintf(format, args...))
+}
+
+// block parses the map or list starting at the current line, which is
+// indented by indent.
+func (p *yamlParser) block(indent int) (interface{}, error) {
+	if isListItem(p.lines[p.i].text) {
+		return p.list(indent)
+	}
+	return p.mapping(indent)
+}
+
+func isListItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) list(indent int) (interface{}, error) {
+	ret := []interface{}{}
+	for p.i < len(p.lines) && p.lines[p.i].indent == indent && isListItem(p.lines[p.i].text) {
+		l := p.lines[p.i]
+		rest := strings.TrimLeft(strings.TrimPrefix(l.text, "-"), " ")
+		if rest == "" {
+			p.i++
+			v, err := p.nested(indent)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, v)
+			continue
+		}
+		if _, _, ok := splitYAMLKey(rest); ok || isListItem(rest) {
+			// A map or list starting on the same line as its dash, like
+			// "- name: Greataxe", continues at the indentation of its first
+			// key.
+			l.indent += len(l.text) - len(rest)
+			l.text = rest
+			v, err := p.block(l.indent)
+			if err != nil {
+				return nil, err
+			}
+			ret = append(ret, v)
+			continue
+		}
+		v, err := p.scalarLine(rest)
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, v)
+	}
+	return ret, nil
+}
+
+func (p *yamlParser) mapping(indent int) (interface{}, error) {
+	ret := make(map[string]interface{})
+	for p.i < len(p.lines) && p.lines[p.i].indent == indent {
+		l := p.lines[p.i]
+		if isListItem(l.text) {
+			return nil, p.errorf("expected a key, not a list item")
+		}
+		k, rest, ok := splitYAMLKey(l.text)
+		if !ok {
+			return nil, p.errorf("expected \"key: value\", got %q", l.text)
+		}
+		if _, dup := ret[k]; dup {
+			return nil, p.errorf("%q is there twice", k)
+		}
+		if rest != "" {
+			v, err := p.scalarLine(rest)
+			if err != nil {
+				return nil, err
+			}
+			ret[k] = v
+			continue
+		}
+		p.i++
+		// Lists can be indented as much as the key they belong to.
+		if p.i < len(p.lines) && p.lines[p.i].indent == indent && isListItem(p.lines[p.i].text) {
+			v, err := p.list(indent)
+			if err != nil {
+				return nil, err
+			}
+			ret[k] = v
+			continue
+		}
+		v, err := p.nested(indent)
+		if err != nil {
+			return nil, err
+		}
+		ret[k] = v
+	}
+	return ret, nil
+}
+
+// nested parses the block under a key or dash indented by indent, if there is
+// one, or returns nil if it's empty.
+func (p *yamlParser) nested(indent int) (interface{}, error) {
+	if p.i >= len(p.lines) || p.lines[p.i].indent <= indent {
+		return nil, nil
+	}
+	return p.block(p.lines[p.i].indent)
+}
+
+// scalarLine parses the value on the rest of the current line and moves on to
+// the next.
+func (p *yamlParser) scalarLine(s string) (interface{}, error) {
+	fp := &yamlFlow{s: s}
+	v, err := fp.value()
+	if err == nil && strings.TrimSpace(fp.s[fp.i:]) != "" {
+		err = fmt.Errorf("unexpected %q", strings.TrimSpace(fp.s[fp.i:]))
+	}
+	if err != nil {
+		return nil, p.errorf("%v", err)
+	}
+	p.i++
+	return v, nil
+}
+
+// splitYAMLKey splits "key: value" into its key and value, which may be empty.
+func splitYAMLKey(text string) (string, string, bool) {
+	if strings.HasPrefix(text, "[") || strings.HasPrefix(text, "{") {
+		return "", "", false
+	}
+	var quote rune
+	for i, r := range text {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case (r == '"' || r == '\'') && i == 0:
+			quote = r
+		case r == ':' && (i+1 == len(text) || text[i+1] == ' '):
+			k, err := yamlScalar(strings.TrimSpace(text[:i]))
+			if err != nil {
+				return "", "", false
+			}
+			return fmt.Sprint(k), strings.TrimSpace(text[i+1:]), true
+		}
+	}
+	return "", "", false
+}
+
+// yamlFlow parses a value on a single line, which may be a [flow, list] or
+// {flow: map}.
+type yamlFlow struct {
+	s string
+	i int
+}
+
+func (fp *yamlFlow) skipSpace() {
+	for fp.i < len(fp.s) && fp.s[fp.i] == ' ' {
+		fp.i++
+	}
+}
+
+func (fp *yamlFlow) value() (interface{}, error) {
+	fp.skipSpace()
+	if fp.i >= len(fp.s) {
+		return nil, nil
+	}
+	switch fp.s[fp.i] {
+	case '[':
+		fp.i++
+		ret := []interface{}{}
+		err := fp.items(']', func() error {
+			v, err := fp.value()
+			ret = append(ret, v)
+			return err
+		})
+		return ret, err
+	case '{':
+		fp.i++
+		ret := make(map[string]interface{})
+		err := fp.items('}', func() error {
+			k, err := fp.scalar(":")
+			if err != nil {
+				return err
+			}
+			fp.skipSpace()
+			if fp.i >= len(fp.s) || fp.s[fp.i] != ':' {
+				return fmt.Errorf("expected a colon after %v", k)
+			}
+			fp.i++
+			v, err := fp.value()
+			ret[fmt.Sprint(k)] = v
+			return err
+		})
+		return ret, err
+	}
+	return fp.scalar("")
+}
+
+// items parses comma-separated items up to the closing bracket.
+func (fp *yamlFlow) items(end byte, item func() error) error {
+	for {
+		fp.skipSpace()
+		if fp.i >= len(fp.s) {
+			return fmt.Errorf("missing %q", end)
+		}
+		if fp.s[fp.i] == end {
+			fp.i++
+			return nil
+		}
+		if err := item(); err != nil {
+			return err
+		}
+		fp.skipSpace()
+		if fp.i < len(fp.s) && fp.s[fp.i] == ',' {
+			fp.i++
+		} else if fp.i < len(fp.s) && fp.s[fp.i] != end {
+			return fmt.Errorf("expected a comma or %q, got %q", end, fp.s[fp.i:])
+		}
+	}
+}
+
+// scalar parses a quoted or plain scalar. Inside a flow collection, plain
+// scalars end at a comma or bracket, or at anything in stop.
+func (fp *yamlFlow) scalar(stop string) (interface{}, error) {
+	fp.skipSpace()
+	start := fp.i
+	if fp.i < len(fp.s) && (fp.s[fp.i] == '"' || fp.s[fp.i] == '\'') {
+		q := fp.s[fp.i]
+		for fp.i++; fp.i < len(fp.s); fp.i++ {
+			if fp.s[fp.i] == '\\' && q == '"' {
+				fp.i++
+				continue
+			}
+			if fp.s[fp.i] == q {
+				// '' is an escaped ' in single quotes.
+				if q == '\'' && fp.i+1 < len(fp.s) && fp.s[fp.i+1] == '\'' {
+					fp.i++
+					continue
+				}
+				fp.i++
+				return yamlScalar(fp.s[start:fp.i])
+			}
+		}
+		return nil, fmt.Errorf("unterminated string %s", fp.s[start:])
+	}
+	inFlow := fp.s[0] == '[' || fp.s[0] == '{'
+	for ; fp.i < len(fp.s); fp.i++ {
+		c := fp.s[fp.i]
+		if inFlow && strings.IndexByte(",]}", c) >= 0 {
+			break
+		}
+		if strings.IndexByte(stop, c) >= 0 && (fp.i+1 == len(fp.s) || fp.s[fp.i+1] == ' ') {
+			break
+		}
+	}
+	return yamlScalar(strings.TrimSpace(fp.s[start:fp.i]))
+}
+
+// yamlScalar works out what a scalar is: a quoted string, null, a boolean, a
+// number or, failing all those, a plain string.
+func yamlScalar(s string) (interface{}, error) {
+	switch {
+	case strings.HasPrefix(s, `"`):
+		v, err := strconv.Unquote(s)
+		if err != nil {
+			return nil, fmt.Errorf("bad string %s: %v", s, err)
+		}
+		return v, nil
+	case strings.HasPrefix(s, "'"):
+		return strings.ReplaceAll(s[1:len(s)-1], "''", "'"), nil
+	case strings.HasPrefix(s, "|") || strings.HasPrefix(s, ">"):
+		return nil, fmt.Errorf("multi-line strings like %s aren't supported in character sheets", s)
+	}
+	switch s {
+	case "", "~", "null", "Null", "NULL":
+		return nil, nil
+	case "true", "True", "TRUE":
+		return true, nil
+	case "false", "False", "FALSE":
+		return false, nil
+	}
+	if n, err := strconv.ParseInt(strings.TrimPrefix(s, "+"), 10, 64); err == nil {
+		return n, nil
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && !strings.ContainsAny(s, "nN") {
+		return f, nil
+	}
+	return s, nil
+}
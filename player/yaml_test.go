@@ -0,0 +1,86 @@
+package player
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestYAMLToJSON(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		yaml string
+		want string
+	}{
+		{"empty", "", `null`},
+		{"scalars", "a: 1\nb: -2.5\nc: true\nd: ~\ne: 1d12\nf: \"7\"\ng: 'it''s'\nh: C# # comment", `{"a": 1, "b": -2.5, "c": true, "d": null, "e": "1d12", "f": "7", "g": "it's", "h": "C#"}`},
+		{"colons", "url: http://x.com\nname: Grub: the Sequel", `{"url": "http://x.com", "name": "Grub: the Sequel"}`},
+		{"nested map", "a:\n  b:\n    c: 1\n  d: 2\ne: 3", `{"a": {"b": {"c": 1}, "d": 2}, "e": 3}`},
+		{"block list", "a:\n  - 1\n  - x y\nb: 2", `{"a": [1, "x y"], "b": 2}`},
+		{"unindented list", "a:\n- 1\n- 2\nb:", `{"a": [1, 2], "b": null}`},
+		{"list of maps", "- a: 1\n  b: 2\n- c: 3\n-\n  d: 4", `[{"a": 1, "b": 2}, {"c": 3}, {"d": 4}]`},
+		{"list of lists", "- - 1\n  - 2\n- [3]", `[[1, 2], [3]]`},
+		{"flow", "a: [x, 'y, z', [1, {b: c}]]\nd: {\"e\" : [], f: }", `{"a": ["x", "y, z", [1, {"b": "c"}]], "d": {"e": [], "f": null}}`},
+		{"document", "---\n# just a comment\na: 1 # another\n", `{"a": 1}`},
+	} {
+		b, err := yamlToJSON([]byte(tc.yaml))
+		if err != nil {
+			t.Errorf("%s: yamlToJSON() = %v", tc.desc, err)
+			continue
+		}
+		var got, want interface{}
+		if err := json.Unmarshal(b, &got); err != nil {
+			t.Fatalf("%s: yamlToJSON() made bad JSON %s: %v", tc.desc, b, err)
+		}
+		if err := json.Unmarshal([]byte(tc.want), &want); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: yamlToJSON() = %s, want %s", tc.desc, b, tc.want)
+		}
+	}
+}
+
+func TestYAMLToJSONErrors(t *testing.T) {
+	for _, tc := range []struct {
+		desc string
+		yaml string
+		want string
+	}{
+		{"tabs", "a:\n\tb: 1", "line 2: YAML can't be indented with tabs"},
+		{"block string", "a: |\n  text", "line 1: multi-line strings"},
+		{"not a key", "a: 1\nb", `line 2: expected "key: value"`},
+		{"duplicate", "a: 1\na: 2", `line 2: "a" is there twice`},
+		{"bad indent", "a:\n    b: 1\n  c: 2", "line 3: unexpected indentation"},
+		{"list in a map", "a: 1\n- 2", "line 2: expected a key"},
+		{"unclosed flow", "a: [1, 2", `line 1: missing ']'`},
+		{"unclosed string", `a: "oops`, "unterminated string"},
+		{"trailing junk", "a: [1] 2", `unexpected "2"`},
+	} {
+		if _, err := yamlToJSON([]byte(tc.yaml)); err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: yamlToJSON() = %v, want an error with %q", tc.desc, err, tc.want)
+		}
+	}
+}
+
+func TestLoadLocalSheet(t *testing.T) {
+	fromJSON, err := (&fileSource{filepath.Join("testdata", "grub.json")}).Load(false)
+	if err != nil {
+		t.Fatalf("Load(grub.json) = %v", err)
+	}
+	fromYAML, err := (&fileSource{filepath.Join("testdata", "grub.yaml")}).Load(false)
+	if err != nil {
+		t.Fatalf("Load(grub.yaml) = %v", err)
+	}
+	if !reflect.DeepEqual(fromYAML, fromJSON) {
+		t.Errorf("got %+v from YAML, want %+v like from JSON", fromYAML, fromJSON)
+	}
+	if fromYAML.Level != 4 || fromYAML.fmtClasses() != "Barbarian 3 / Rogue 1" {
+		t.Errorf("got level %d %s, want 4 Barbarian 3 / Rogue 1", fromYAML.Level, fromYAML.fmtClasses())
+	}
+	if len(fromYAML.Weapons) != 2 || fromYAML.Weapons[1].Name != "Grandmother's Spoon" || fromYAML.Weapons[1].Magic != 1 {
+		t.Errorf("got weapons %+v, want a greataxe and a +1 spoon", fromYAML.Weapons)
+	}
+}
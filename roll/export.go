@@ -0,0 +1,180 @@
+package roll
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"dicebae/baepi"
+)
+
+var (
+	maxExportEntries = 1000
+	// A relative age, e.g., 90m, 2h, 3d or 1w.
+	ageRegexp = regexp.MustCompile(`^(\d+)([mhdw])$`)
+	ageUnits  = map[string]time.Duration{
+		"m": time.Minute,
+		"h": time.Hour,
+		"d": 24 * time.Hour,
+		"w": 7 * 24 * time.Hour,
+	}
+)
+
+// ExportHandler implements the BaeSayHandler interface for exporting the roll
+// history of a channel as a CSV or JSON file.
+type ExportHandler struct{}
+
+// ExportRecord is a single exported roll.
+type ExportRecord struct {
+	User       string    `json:"user"`
+	Time       time.Time `json:"time"`
+	Expression string    `json:"expression"`
+	Dice       string    `json:"dice"`
+	Total      int       `json:"total"`
+	Crits      int       `json:"crits"`
+	CritFails  int       `json:"critFails"`
+	Label      string    `json:"label,omitempty"`
+}
+
+func NewExportHandler() *ExportHandler {
+	return &ExportHandler{}
+}
+
+func (eh *ExportHandler) ShouldSay(db baepi.DiceBae, e *baepi.Baevent) bool {
+	return strings.HasPrefix(e.Message, "!export")
+}
+
+func (eh *ExportHandler) SayWithBae(db baepi.DiceBae, e *baepi.Baevent) (*baepi.Baesponse, error) {
+	since, format := time.Time{}, "csv"
+	for _, tk := range strings.Fields(strings.TrimPrefix(e.Message, "!export")) {
+		switch tk = strings.ToLower(tk); tk {
+		case "csv", "json":
+			format = tk
+		default:
+			t, err := parseSince(tk, time.Now())
+			if err != nil {
+				return &baepi.Baesponse{
+					Message:     fmt.Sprintf("I don't know when %q is. Try !export [2h|3d|2006-01-02] [csv|json].", tk),
+					MentionUser: true,
+				}, nil
+			}
+			since = t
+		}
+	}
+
+	hist := db.FetchHistory(&baepi.BaeHistoKey{
+		HandlerName: "roll",
+		ChannelID:   e.ChannelID,
+		Since:       since,
+	}, maxExportEntries)
+	var recs []*ExportRecord
+	// History is newest first, but a spreadsheet wants it oldest first.
+	for i := len(hist) - 1; i >= 0; i-- {
+		if rec := newExportRecord(hist[i]); rec != nil {
+			recs = append(recs, rec)
+		}
+	}
+	if len(recs) == 0 {
+		return &baepi.Baesponse{Message: "Nothing to export, go roll something.", MentionUser: true}, nil
+	}
+
+	var data []byte
+	var err error
+	contentType := "text/csv"
+	if format == "json" {
+		contentType = "application/json"
+		data, err = json.MarshalIndent(recs, "", "  ")
+	} else {
+		data, err = exportCSV(recs)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to export %d rolls as %s: %v", len(recs), format, err)
+	}
+	name := fmt.Sprintf("rolls-%s.%s", time.Now().Format("2006-01-02"), format)
+	return &baepi.Baesponse{
+		Message:     fmt.Sprintf("Here's %d rolls, nerd.", len(recs)),
+		MentionUser: true,
+		Files: []*baepi.BaeFile{{
+			Name:        name,
+			ContentType: contentType,
+			Data:        data,
+		}},
+	}, nil
+}
+
+// newExportRecord flattens a roll history entry, returning nil for entries
+// that aren't real rolls.
+func newExportRecord(bhe *baepi.BaeHistoryEntry) *ExportRecord {
+	rr, ok := bhe.Response.HandlerMetadata.(RollResponse)
+	if !ok || rr.TrollResponse != "" {
+		return nil
+	}
+	rec := &ExportRecord{
+		Time:  bhe.TimeSaid,
+		Total: rr.Total,
+		Label: rr.Label,
+	}
+	if bhe.RepliedTo != nil {
+		rec.User = bhe.RepliedTo.Username
+	}
+	var exprs, dice []string
+	for _, res := range rr.Results {
+		exprs = append(exprs, res.Request.String())
+		var brs []string
+		for _, br := range res.BaseRolls {
+			brs = append(brs, strconv.Itoa(br))
+		}
+		dice = append(dice, strings.Join(brs, " "))
+		if res.IsCrit {
+			rec.Crits++
+		}
+		if res.IsCritFail {
+			rec.CritFails++
+		}
+	}
+	rec.Expression = strings.Join(exprs, ", ")
+	rec.Dice = strings.Join(dice, "; ")
+	return rec
+}
+
+func exportCSV(recs []*ExportRecord) ([]byte, error) {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"user", "time", "expression", "dice", "total", "crits", "crit_fails", "label"})
+	for _, r := range recs {
+		w.Write([]string{
+			r.User,
+			r.Time.Format(time.RFC3339),
+			r.Expression,
+			r.Dice,
+			strconv.Itoa(r.Total),
+			strconv.Itoa(r.Crits),
+			strconv.Itoa(r.CritFails),
+			r.Label,
+		})
+	}
+	w.Flush()
+	return buf.Bytes(), w.Error()
+}
+
+// parseSince parses either an age relative to now (90m, 2h, 3d, 1w) or a
+// calendar date (2006-01-02) into the time it refers to.
+func parseSince(s string, now time.Time) (time.Time, error) {
+	if sub := ageRegexp.FindStringSubmatch(s); sub != nil {
+		n, err := strconv.Atoi(sub[1])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("failed to parse age %q: %v", s, err)
+		}
+		return now.Add(-time.Duration(n) * ageUnits[sub[2]]), nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", s, now.Location())
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse date %q: %v", s, err)
+	}
+	return t, nil
+}
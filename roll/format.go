@@ -7,6 +7,9 @@ import (
 )
 
 func (rs *RollRequest) String() string {
+	if rs.Die == 0 {
+		return strconv.Itoa(rs.Modifier)
+	}
 	var tks []string
 	if rs.Multiplier != 1 {
 		tks = append(tks, strconv.Itoa(rs.Multiplier))
@@ -15,10 +18,29 @@ func (rs *RollRequest) String() string {
 	if rs.Modifier != 0 {
 		tks = append(tks, fmt.Sprintf("%+d", rs.Modifier))
 	}
+	switch rs.Advantage {
+	case WithAdvantage:
+		tks = append(tks, "(adv)")
+	case WithDisadvantage:
+		tks = append(tks, "(dis)")
+	}
 	return strings.Join(tks, "")
 }
 
+// fmtDropped formats the dice thrown away by advantage or disadvantage.
+func (rr *RollResult) fmtDropped() string {
+	var s string
+	for _, d := range rr.Dropped {
+		s += fmt.Sprintf(" ~~%d~~", d)
+	}
+	return s
+}
+
 func (rr *RollResult) String() string {
+	if rr.Request.Die == 0 {
+		// Flat amounts have nothing to show but the total.
+		return fmt.Sprintf("**%d**", rr.Result)
+	}
 	s := []string{rr.Request.String(), "->"}
 	if len(rr.BaseRolls) == 1 && rr.Request.Modifier == 0 {
 		// Format unmodified, single die roll: dXX->Result
@@ -30,6 +52,7 @@ func (rr *RollResult) String() string {
 		default:
 			s = append(s, fmt.Sprintf("**%d**", rr.Result))
 		}
+		s = append(s, rr.fmtDropped())
 		return strings.Join(s, "")
 	}
 	// Format multi-die roll: dXX->r1+r2+...+rn
@@ -54,7 +77,7 @@ func (rr *RollResult) String() string {
 			s = append(s, fmt.Sprintf("%d", br))
 		}
 	}
-	s = append(s, "*")
+	s = append(s, "*", rr.fmtDropped())
 	// Append modifier
 	if rr.Request.Modifier != 0 {
 		s = append(s, fmt.Sprintf("%+d", rr.Request.Modifier))
@@ -72,9 +95,16 @@ func (rr *RollResponse) String() string {
 	for _, r := range rr.Results {
 		ss = append(ss, r.String())
 	}
+	var label, damage string
+	if rr.Label != "" {
+		label = fmt.Sprintf("*%s:* ", rr.Label)
+	}
+	if rr.Damage != nil {
+		damage = "\nDamage: " + rr.Damage.String()
+	}
 	if len(ss) == 1 {
-		return fmt.Sprintf("%s", ss[0])
+		return fmt.Sprintf("%s%s%s", label, ss[0], damage)
 	} else {
-		return fmt.Sprintf("%s Total=**%d**", strings.Join(ss, ", "), rr.Total)
+		return fmt.Sprintf("%s%s Total=**%d**%s", label, strings.Join(ss, ", "), rr.Total, damage)
 	}
 }
@@ -1,8 +1,10 @@
 package roll
 
 import (
+	"fmt"
 	"sort"
 	"strings"
+	"time"
 
 	"dicebae/baepi"
 )
@@ -21,9 +23,21 @@ func (hh *HistoryHandler) ShouldSay(db baepi.DiceBae, e *baepi.Baevent) bool {
 }
 
 func (hh *HistoryHandler) SayWithBae(db baepi.DiceBae, e *baepi.Baevent) (*baepi.Baesponse, error) {
-	hist := db.FetchHistory(&baepi.BaeHistoKey{HandlerName: "roll"}, 100)
+	q, err := parseHistoryQuery(e, strings.TrimPrefix(e.Message, "!"+hh.hotword), time.Now())
+	if err != nil {
+		return say(fmt.Sprintf("%v. %s", err, queryUsage)), nil
+	}
+	if q.filtered {
+		return hh.list(db, q), nil
+	}
+	return hh.summarize(db, q), nil
+}
+
+// summarize replies with the latest few rolls of everyone who rolled recently.
+func (hh *HistoryHandler) summarize(db baepi.DiceBae, q *historyQuery) *baepi.Baesponse {
+	hist := db.FetchHistory(&q.key, 100)
 	if len(hist) == 0 {
-		return &baepi.Baesponse{Message: "History of what?"}, nil
+		return &baepi.Baesponse{Message: "History of what?"}
 	}
 	// Split by replied-to user.
 	histPerBF := make(map[baepi.BaestFriend][]*baepi.BaeHistoryEntry)
@@ -62,5 +76,39 @@ func (hh *HistoryHandler) SayWithBae(db baepi.DiceBae, e *baepi.Baevent) (*baepi
 	}
 	return &baepi.Baesponse{
 		Message: strings.Join(out, "\n"),
-	}, nil
+	}
+}
+
+// list replies with one page of the rolls matching the query, newest first.
+func (hh *HistoryHandler) list(db baepi.DiceBae, q *historyQuery) *baepi.Baesponse {
+	n := maxQueryEntries
+	if q.count > 0 {
+		n = q.count
+	}
+	hist := db.FetchHistory(&q.key, n)
+	if len(hist) == 0 {
+		return &baepi.Baesponse{Message: "Nothing like that in my history."}
+	}
+	pages := (len(hist) + historyPageSize - 1) / historyPageSize
+	if q.page > pages {
+		return &baepi.Baesponse{Message: fmt.Sprintf("There are only %d pages, chill.", pages)}
+	}
+	out := []string{fmt.Sprintf("**%d matching rolls (newest --> oldest)**", len(hist))}
+	first, last := (q.page-1)*historyPageSize, q.page*historyPageSize
+	if last > len(hist) {
+		last = len(hist)
+	}
+	for _, bhe := range hist[first:last] {
+		who := "someone"
+		if bhe.RepliedTo != nil {
+			who = bhe.RepliedTo.Username
+		}
+		out = append(out, fmt.Sprintf("`%s` %s: %s", bhe.TimeSaid.Format("Jan 2 15:04"), who, bhe.Response.Message))
+	}
+	if q.page < pages {
+		out = append(out, fmt.Sprintf("Page %d/%d, add \"page %d\" for more.", q.page, pages, q.page+1))
+	}
+	return &baepi.Baesponse{
+		Message: strings.Join(out, "\n"),
+	}
 }
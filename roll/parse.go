@@ -7,7 +7,8 @@ import (
 	"strings"
 )
 
-func parseRollRequests(msg string) ([]*RollRequest, error) {
+// ParseRollRequests parses every roll expression (XdN[+|-]Mod) in msg.
+func ParseRollRequests(msg string) ([]*RollRequest, error) {
 	var ret []*RollRequest
 	var errs []error
 	for _, sub := range rollRegexp.FindAllStringSubmatch(msg, -1) {
@@ -47,6 +48,16 @@ func parseRollRequests(msg string) ([]*RollRequest, error) {
 	return ret, nil
 }
 
+// splitLabel splits a message into the part containing roll expressions and
+// the label following a lone #, if any.
+func splitLabel(msg string) (expr, label string) {
+	loc := labelRegexp.FindStringSubmatchIndex(msg)
+	if loc == nil {
+		return msg, ""
+	}
+	return msg[:loc[0]], strings.TrimSpace(msg[loc[2]:loc[3]])
+}
+
 func checkForTrolls(r *RollRequest) string {
 	// Validate strings before parsing for weird input.
 	switch {
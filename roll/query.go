@@ -0,0 +1,168 @@
+package roll
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"dicebae/baepi"
+)
+
+var (
+	maxQueryEntries = 1000
+	historyPageSize = 10
+	mentionRegexp   = regexp.MustCompile(`^<@!?(\d+)>$`)
+	dieRegexp       = regexp.MustCompile(`^[dD](\d+)$`)
+	thresholdRegexp = regexp.MustCompile(`^(>=|<=|>|<|=)(-?\d+)$`)
+	// Words that read nicely in a query but don't mean anything.
+	queryFillers = map[string]bool{"only": true, "rolls": true, "roll": true, "with": true}
+	queryUsage   = "Try something like !history @someone d20 last 2h crits only, or !history >25 page 2."
+)
+
+// historyQuery is a parsed !history request. Every constraint is optional.
+type historyQuery struct {
+	key baepi.BaeHistoKey
+	// filtered is set if anything beyond the channel was constrained, in which
+	// case matching rolls are listed rather than summarized per user.
+	filtered bool
+	die      int
+	crits    bool
+	fails    bool
+	label    string
+	min, max *int
+	// count limits the number of rolls listed; zero means no limit.
+	count int
+	page  int
+}
+
+// parseHistoryQuery parses filters like "@kira d20 last 2h crits only" or ">25
+// page 2" from the arguments of a history command.
+func parseHistoryQuery(e *baepi.Baevent, args string, now time.Time) (*historyQuery, error) {
+	q := &historyQuery{
+		key:  baepi.BaeHistoKey{HandlerName: "roll", ChannelID: e.ChannelID},
+		page: 1,
+	}
+	tks := strings.Fields(args)
+	// next consumes the token after a keyword like "last" or "page".
+	next := func(i *int, kw string) (string, error) {
+		if *i+1 >= len(tks) {
+			return "", fmt.Errorf("%q needs something after it", kw)
+		}
+		*i++
+		return strings.ToLower(tks[*i]), nil
+	}
+	for i := 0; i < len(tks); i++ {
+		tk := tks[i]
+		lower := strings.ToLower(tk)
+		switch {
+		case mentionRegexp.MatchString(tk):
+			q.key.BaestFriendID = mentionRegexp.FindStringSubmatch(tk)[1]
+		case lower == "me" || lower == "mine":
+			q.key.BaestFriendID = e.Speaker.ID
+		case dieRegexp.MatchString(tk):
+			q.die, _ = strconv.Atoi(dieRegexp.FindStringSubmatch(tk)[1])
+		case lower == "crit" || lower == "crits" || lower == "nat20" || lower == "nat20s":
+			q.crits = true
+		case lower == "fail" || lower == "fails" || lower == "fumble" || lower == "fumbles" || lower == "nat1" || lower == "nat1s":
+			q.fails = true
+		case strings.HasPrefix(tk, "#") && len(tk) > 1:
+			q.label = strings.ToLower(tk[1:])
+		case strings.HasPrefix(lower, "label:") && len(tk) > len("label:"):
+			q.label = strings.ToLower(tk[len("label:"):])
+		case thresholdRegexp.MatchString(tk):
+			if err := q.parseThreshold(tk); err != nil {
+				return nil, err
+			}
+		case lower == "last" || lower == "since":
+			arg, err := next(&i, lower)
+			if err != nil {
+				return nil, err
+			}
+			if n, err := strconv.Atoi(arg); err == nil && lower == "last" {
+				q.count = n
+				break
+			}
+			t, err := parseSince(arg, now)
+			if err != nil {
+				return nil, err
+			}
+			q.key.Since = t
+		case lower == "page":
+			arg, err := next(&i, lower)
+			if err != nil {
+				return nil, err
+			}
+			if q.page, err = strconv.Atoi(arg); err != nil || q.page < 1 {
+				return nil, fmt.Errorf("%q isn't a page", arg)
+			}
+		case queryFillers[lower]:
+		default:
+			return nil, fmt.Errorf("I don't know what %q means", tk)
+		}
+	}
+	q.filtered = len(tks) > 0
+	q.key.Filter = IsRoll
+	if q.die > 0 || q.crits || q.fails || q.label != "" || q.min != nil || q.max != nil {
+		q.key.Filter = func(he *baepi.BaeHistoryEntry) bool {
+			rr, ok := he.Response.HandlerMetadata.(RollResponse)
+			return ok && q.matches(rr)
+		}
+	}
+	return q, nil
+}
+
+func (q *historyQuery) parseThreshold(tk string) error {
+	sub := thresholdRegexp.FindStringSubmatch(tk)
+	v, err := strconv.Atoi(sub[2])
+	if err != nil {
+		return fmt.Errorf("%q isn't a number", sub[2])
+	}
+	// Store inclusive bounds.
+	lo, hi := v, v
+	switch sub[1] {
+	case ">":
+		lo++
+		q.min = &lo
+	case ">=":
+		q.min = &lo
+	case "<":
+		hi--
+		q.max = &hi
+	case "<=":
+		q.max = &hi
+	case "=":
+		q.min, q.max = &lo, &hi
+	}
+	return nil
+}
+
+// matches returns whether a roll satisfies the query's roll-specific filters.
+func (q *historyQuery) matches(rr RollResponse) bool {
+	if rr.TrollResponse != "" {
+		return false
+	}
+	switch {
+	case q.min != nil && rr.Total < *q.min:
+		return false
+	case q.max != nil && rr.Total > *q.max:
+		return false
+	case q.label != "" && !strings.Contains(strings.ToLower(rr.Label), q.label):
+		return false
+	}
+	if q.die == 0 && !q.crits && !q.fails {
+		return true
+	}
+	// The die and crit filters need to be satisfied by the same result.
+	for _, res := range rr.Results {
+		switch {
+		case q.die > 0 && res.Request.Die != q.die:
+		case q.crits && !res.IsCrit:
+		case q.fails && !res.IsCritFail:
+		default:
+			return true
+		}
+	}
+	return false
+}
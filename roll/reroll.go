@@ -0,0 +1,120 @@
+package roll
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"dicebae/baepi"
+)
+
+var (
+	maxRerollDepth = 10
+)
+
+// RerollHandler implements the BaeSayHandler interface for redoing a user's
+// earlier roll. The earlier roll stays in history, marked as superseded.
+type RerollHandler struct {
+	rh *RollHandler
+}
+
+// NewRerollHandler returns a handler that rolls with the same dice as rh.
+func NewRerollHandler(rh *RollHandler) *RerollHandler {
+	return &RerollHandler{rh: rh}
+}
+
+func (rr *RerollHandler) ShouldSay(db baepi.DiceBae, e *baepi.Baevent) bool {
+	return strings.HasPrefix(e.Message, "!reroll")
+}
+
+// SayWithBae handles "!reroll [n] [+mod]", rerolling the user's nth most recent
+// roll, optionally replacing the modifier of its first expression.
+func (rr *RerollHandler) SayWithBae(db baepi.DiceBae, e *baepi.Baevent) (*baepi.Baesponse, error) {
+	n, mod, hasMod := 1, 0, false
+	for _, tk := range strings.Fields(strings.TrimPrefix(e.Message, "!reroll")) {
+		if strings.HasPrefix(tk, "+") || strings.HasPrefix(tk, "-") {
+			m, err := parseModifier(tk)
+			if err != nil {
+				return say(fmt.Sprintf("%q isn't a modifier.", tk)), nil
+			}
+			mod, hasMod = m, true
+			continue
+		}
+		v, err := strconv.Atoi(tk)
+		if err != nil || v < 1 {
+			return say("Try !reroll [n] [+mod], e.g., !reroll 2 +3."), nil
+		}
+		n = v
+	}
+	if n > maxRerollDepth {
+		return say("I don't remember that far back."), nil
+	}
+
+	hist := db.FetchHistory(&baepi.BaeHistoKey{
+		BaestFriendID: e.Speaker.ID,
+		HandlerName:   "roll",
+		ChannelID:     e.ChannelID,
+		Filter:        IsRoll,
+	}, n)
+	if len(hist) < n {
+		return say("You haven't rolled that much."), nil
+	}
+	old := hist[n-1]
+	prev, ok := old.Response.HandlerMetadata.(RollResponse)
+	if !ok || prev.TrollResponse != "" || len(prev.Results) == 0 {
+		return say("I'm not rerolling that."), nil
+	}
+
+	reqs := copyRequests(prev.Results)
+	if hasMod {
+		reqs[0].Modifier = mod
+		reqs[0].TrollMsg = checkForTrolls(reqs[0])
+	}
+	resp := RollAll(rr.rh.kelgwynFrustrator, reqs)
+	resp.Label = prev.Label
+	if prev.Damage != nil {
+		resp.Damage = rerollDamage(rr.rh.kelgwynFrustrator, prev, resp)
+	}
+	return &baepi.Baesponse{
+		Message:         fmt.Sprintf("%s (was %d)", resp.String(), prev.Total),
+		MentionUser:     true,
+		HandlerMetadata: resp,
+		Supersedes:      old.ID,
+	}, nil
+}
+
+func copyRequests(results []*RollResult) []*RollRequest {
+	var reqs []*RollRequest
+	for _, res := range results {
+		req := *res.Request
+		reqs = append(reqs, &req)
+	}
+	return reqs
+}
+
+// rerollDamage rerolls the damage of an attack, doubling or undoubling its
+// dice if the reroll crit when the original didn't, or the other way around.
+func rerollDamage(rng *rand.Rand, prev RollResponse, resp RollResponse) *RollResponse {
+	reqs := copyRequests(prev.Damage.Results)
+	wasCrit, isCrit := prev.Results[0].IsCrit, resp.Results[0].IsCrit
+	for _, r := range reqs {
+		switch {
+		case wasCrit && !isCrit:
+			r.Multiplier /= 2
+		case isCrit && !wasCrit:
+			r.Multiplier *= 2
+		}
+	}
+	dmg := RollAll(rng, reqs)
+	// Damage dice can't crit, whatever they roll.
+	for _, r := range dmg.Results {
+		r.IsCrit, r.IsCritFail = false, false
+	}
+	dmg.Label = prev.Damage.Label
+	return &dmg
+}
+
+func say(msg string) *baepi.Baesponse {
+	return &baepi.Baesponse{Message: msg, MentionUser: true}
+}
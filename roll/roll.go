@@ -3,6 +3,7 @@
 package roll
 
 import (
+	"fmt"
 	"math/rand"
 	"regexp"
 	"strings"
@@ -18,22 +19,39 @@ var (
 	maxAbsModifier    = 10000
 	maxComputedRolls  = 1000000
 	rollRegexp        = regexp.MustCompile(`(\d*)\s*[dD](\d+)\s*([+-]\s*\d+)?`)
+	rollCommandRegexp = regexp.MustCompile(`^!r(oll)?\b`)
+	// Anything after a lone # is a label for the roll, e.g., "d20+3 # stealth".
+	labelRegexp = regexp.MustCompile(`(?:^|\s)#\s*(.*)$`)
 )
 
 // RollHandler implements the BaeSayHandler interface for rolling 'dem bones.
 type RollHandler struct {
 	kelgwynFrustrator *rand.Rand
+	variables         VariableResolver
 }
 
 // RollRequest stores a parsed user roll request (XdN[+|-]Mod) along with a
-// troll message if the request was dumb.
+// troll message if the request was dumb. A request without a Die is a flat
+// amount, like an unarmed strike's damage, and only adds its Modifier.
 type RollRequest struct {
 	Multiplier int
 	Die        int
 	Modifier   int
 	TrollMsg   string
+	// Advantage only applies to requests for a single die.
+	Advantage Advantage
 }
 
+// Advantage says whether a single die is rolled twice, keeping the higher or
+// lower of the two.
+type Advantage int
+
+const (
+	NoAdvantage Advantage = iota
+	WithAdvantage
+	WithDisadvantage
+)
+
 // RollResult stores the outcome of rolling a single RollRequest.
 type RollResult struct {
 	Request    *RollRequest
@@ -41,6 +59,8 @@ type RollResult struct {
 	BaseRolls  []int
 	IsCrit     bool
 	IsCritFail bool
+	// Dropped holds the die thrown away by advantage or disadvantage.
+	Dropped []int
 }
 
 // RollResult stores the outcome of rolling potentially many RollRequest, and
@@ -50,6 +70,21 @@ type RollResponse struct {
 	Total         int
 	Results       []*RollResult
 	TrollResponse string
+	Label         string
+	// Damage holds the damage rolled off the back of this roll, e.g., when an
+	// attack roll hits.
+	Damage *RollResponse
+}
+
+func init() {
+	baepi.RegisterMetadata("roll.RollResponse", RollResponse{})
+}
+
+// IsRoll is a BaeHistoKey filter for actual rolls, leaving out other replies
+// saved under "roll", like complaints about bad dice or unknown characters.
+func IsRoll(bhe *baepi.BaeHistoryEntry) bool {
+	_, ok := bhe.Response.HandlerMetadata.(RollResponse)
+	return ok
 }
 
 func NewRollHandler() *RollHandler {
@@ -59,20 +94,53 @@ func NewRollHandler() *RollHandler {
 }
 
 func (rh *RollHandler) ShouldSay(db baepi.DiceBae, e *baepi.Baevent) bool {
-	return len(rollRegexp.FindAllStringSubmatch(e.Message, -1)) > 0
+	// Other commands, like "!history d20", may mention dice without wanting
+	// them rolled.
+	if strings.HasPrefix(e.Message, "!") && !rollCommandRegexp.MatchString(e.Message) {
+		return false
+	}
+	expr, _ := splitLabel(e.Message)
+	return len(rollRegexp.FindAllStringSubmatch(expr, -1)) > 0
 }
 
 func (rh *RollHandler) SayWithBae(db baepi.DiceBae, e *baepi.Baevent) (*baepi.Baesponse, error) {
-	reqs, err := parseRollRequests(e.Message)
-	if err != nil {
+	expr, label := splitLabel(e.Message)
+	var reqs, extra []*RollRequest
+	var err error
+	if hasVariables(expr) {
+		var vars []string
+		if reqs, vars, err = resolveVariables(rh.variables, e, expr); err != nil {
+			return say(err.Error() + "."), nil
+		}
+		var why string
+		if extra, why = applyEffects(rh.variables, e, reqs, vars); why != "" {
+			label = strings.TrimSpace(fmt.Sprintf("%s (%s)", label, why))
+		}
+	} else if reqs, err = ParseRollRequests(expr); err != nil {
 		return nil, err
 	}
 
 	// Roll 'dem bones.
+	resp := RollAll(rh.kelgwynFrustrator, append(reqs, extra...))
+	// Extra dice, like bless's d4, can't crit.
+	for _, res := range resp.Results[len(reqs):] {
+		res.IsCrit, res.IsCritFail = false, false
+	}
+	resp.Label = label
+	return &baepi.Baesponse{
+		Message:         resp.String(),
+		MentionUser:     true,
+		HandlerMetadata: resp,
+	}, nil
+}
+
+// RollAll rolls every request and totals the results. If any request was dumb,
+// the response is a troll response.
+func RollAll(rng *rand.Rand, reqs []*RollRequest) RollResponse {
 	var resp RollResponse
 	var trolls []string
 	for _, req := range reqs {
-		res := req.Roll(rh.kelgwynFrustrator)
+		res := req.Roll(rng)
 		resp.Total += res.Result
 		resp.Results = append(resp.Results, res)
 		if req.TrollMsg != "" {
@@ -85,12 +153,7 @@ func (rh *RollHandler) SayWithBae(db baepi.DiceBae, e *baepi.Baevent) (*baepi.Ba
 	case len(trolls) > 0:
 		resp.TrollResponse = strings.Join(trolls, " Also: ")
 	}
-
-	return &baepi.Baesponse{
-		Message:         resp.String(),
-		MentionUser:     true,
-		HandlerMetadata: resp,
-	}, nil
+	return resp
 }
 
 func (rs *RollRequest) Roll(rng *rand.Rand) *RollResult {
@@ -102,17 +165,26 @@ func (rs *RollRequest) Roll(rng *rand.Rand) *RollResult {
 		}
 	}
 	var sum int
-	var br []int
+	var br, dropped []int
 	for i := 0; i < rs.Multiplier; i++ {
 		r := rng.Intn(rs.Die) + 1
 		br = append(br, r)
 		sum += r
 	}
+	if rs.Multiplier == 1 && rs.Advantage != NoAdvantage {
+		r := rng.Intn(rs.Die) + 1
+		if (rs.Advantage == WithAdvantage) == (r > br[0]) {
+			br[0], r = r, br[0]
+			sum = br[0]
+		}
+		dropped = []int{r}
+	}
 	return &RollResult{
 		Request:    rs,
 		Result:     sum + rs.Modifier,
 		BaseRolls:  br,
 		IsCrit:     len(br) == 1 && br[0] == rs.Die,
 		IsCritFail: len(br) == 1 && br[0] == 1,
+		Dropped:    dropped,
 	}
 }
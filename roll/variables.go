@@ -0,0 +1,160 @@
+package roll
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"dicebae/baepi"
+)
+
+var (
+	variableRegexp = regexp.MustCompile(`([+-])\s*@([a-zA-Z]+(?:\.[a-zA-Z]+)?)`)
+	// termRegexp matches each term of a roll expression with variables: dice,
+	// a variable or a flat modifier, with its sign.
+	termRegexp = regexp.MustCompile(`([+-]?)\s*(\d*\s*[dD]\d+)|([+-])\s*@([a-zA-Z]+(?:\.[a-zA-Z]+)?)|([+-])\s*(\d+)`)
+	// rollKindRegexp matches a word saying what kind of d20 roll a message is.
+	rollKindRegexp = regexp.MustCompile(`(?i)\b(attack|check|save)\b`)
+)
+
+// VariableResolver looks up the values of variables like @dex or @str.mod in
+// roll expressions, for whoever is rolling in the event's guild.
+type VariableResolver interface {
+	ResolveVariable(e *baepi.Baevent, name string) (int, error)
+}
+
+// RollKind is the kind of d20 roll a roll with variables makes, which decides
+// what else affects it.
+type RollKind int
+
+const (
+	CheckRoll RollKind = iota
+	SaveRoll
+	AttackRoll
+)
+
+// EffectResolver is a VariableResolver that also knows what else affects the
+// roller's d20 rolls, like their character's conditions.
+type EffectResolver interface {
+	VariableResolver
+	// RollEffects returns the advantage a d20 roll of the given kind with the
+	// given variables gets, any dice to add to it, like bless's d4, and why,
+	// if anything changed.
+	RollEffects(e *baepi.Baevent, kind RollKind, vars []string) (Advantage, []*RollRequest, string)
+}
+
+// ResolveVariablesWith lets rolls use variables, looked up by vr. If vr is an
+// EffectResolver, rolls with variables get the roller's effects too.
+func (rh *RollHandler) ResolveVariablesWith(vr VariableResolver) {
+	rh.variables = vr
+}
+
+// hasVariables returns whether a roll expression uses any variables, as
+// opposed to just mentioning someone.
+func hasVariables(expr string) bool {
+	return variableRegexp.MatchString(expr)
+}
+
+// resolveVariables parses a roll expression with variables. Each variable's
+// value, like any other flat modifier, is added to the dice before it, or the
+// first dice if it comes before them all, since a roll only has one modifier.
+// It returns the requests and the variables used.
+func resolveVariables(vr VariableResolver, e *baepi.Baevent, expr string) ([]*RollRequest, []string, error) {
+	if vr == nil {
+		return nil, nil, fmt.Errorf("@ variables need characters, and I don't know any")
+	}
+	var reqs []*RollRequest
+	var vars, errs []string
+	before := 0
+	for _, sub := range termRegexp.FindAllStringSubmatch(expr, -1) {
+		var n int
+		switch {
+		case sub[2] != "":
+			if sub[1] == "-" {
+				return nil, nil, fmt.Errorf("I can add dice, but not take them away")
+			}
+			rs, err := ParseRollRequests(sub[2])
+			if err != nil {
+				return nil, nil, err
+			}
+			reqs = append(reqs, rs...)
+			continue
+		case sub[4] != "":
+			name := strings.ToLower(sub[4])
+			v, err := vr.ResolveVariable(e, name)
+			if err != nil {
+				errs = append(errs, err.Error())
+				continue
+			}
+			vars = append(vars, name)
+			n = v
+			if sub[3] == "-" {
+				n = -n
+			}
+		default:
+			v, err := strconv.Atoi(sub[6])
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s is too much of a modifier", sub[6])
+			}
+			n = v
+			if sub[5] == "-" {
+				n = -n
+			}
+		}
+		if len(reqs) == 0 {
+			before += n
+		} else {
+			reqs[len(reqs)-1].Modifier += n
+		}
+	}
+	if len(errs) > 0 {
+		return nil, nil, fmt.Errorf("%s", strings.Join(errs, ", "))
+	}
+	if len(reqs) == 0 {
+		return nil, nil, fmt.Errorf("there are no dice in there to roll")
+	}
+	reqs[0].Modifier += before
+	for _, r := range reqs {
+		r.TrollMsg = checkForTrolls(r)
+	}
+	return reqs, vars, nil
+}
+
+// rollKind works out what kind of d20 roll a message is: whatever a word like
+// "attack" or "save" in it says, or else a save if it adds a save bonus, and a
+// check otherwise.
+func rollKind(msg string, vars []string) RollKind {
+	// Leave out the variables, so @dex.save doesn't say "save".
+	switch strings.ToLower(rollKindRegexp.FindString(variableRegexp.ReplaceAllString(msg, ""))) {
+	case "attack":
+		return AttackRoll
+	case "save":
+		return SaveRoll
+	case "check":
+		return CheckRoll
+	}
+	for _, v := range vars {
+		if strings.HasSuffix(v, ".save") {
+			return SaveRoll
+		}
+	}
+	return CheckRoll
+}
+
+// applyEffects gives the first lone d20 in a roll with variables whatever the
+// roller's effects do to it. It returns any dice to add to the roll and why.
+func applyEffects(vr VariableResolver, e *baepi.Baevent, reqs []*RollRequest, vars []string) ([]*RollRequest, string) {
+	er, ok := vr.(EffectResolver)
+	if !ok || len(vars) == 0 {
+		return nil, ""
+	}
+	for _, r := range reqs {
+		if r.Die == 20 && r.Multiplier == 1 {
+			adv, extra, why := er.RollEffects(e, rollKind(e.Message, vars), vars)
+			r.Advantage = adv
+			return extra, why
+		}
+	}
+	return nil, ""
+}
@@ -0,0 +1,175 @@
+package roll
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"dicebae/baepi"
+)
+
+// fakeVariables resolves variables from a map.
+type fakeVariables map[string]int
+
+func (fv fakeVariables) ResolveVariable(e *baepi.Baevent, name string) (int, error) {
+	if n, ok := fv[name]; ok {
+		return n, nil
+	}
+	return 0, fmt.Errorf("I don't know what @%s is", name)
+}
+
+// fmtRequests formats requests like "1d20+3", for comparing.
+func fmtRequests(reqs []*RollRequest) []string {
+	var ss []string
+	for _, r := range reqs {
+		ss = append(ss, fmt.Sprintf("%dd%d%+d", r.Multiplier, r.Die, r.Modifier))
+	}
+	return ss
+}
+
+func TestResolveVariables(t *testing.T) {
+	vars := fakeVariables{"str": 3, "dex": 2, "prof": 2, "str.save": 5}
+	e := &baepi.Baevent{}
+	for _, tc := range []struct {
+		expr     string
+		want     []string
+		wantVars []string
+	}{
+		{"!roll 1d20+@dex", []string{"1d20+2"}, []string{"dex"}},
+		{"!roll d20 + @str + @prof", []string{"1d20+5"}, []string{"str", "prof"}},
+		{"!roll 1d20+@str+3-1", []string{"1d20+5"}, []string{"str"}},
+		{"!roll 1d8+@str+1d6", []string{"1d8+3", "1d6+0"}, []string{"str"}},
+		{"!roll 2d6+@str+1d4+@dex", []string{"2d6+3", "1d4+2"}, []string{"str", "dex"}},
+		{"!roll 1d20-@dex", []string{"1d20-2"}, []string{"dex"}},
+		{"!roll 1d20+@STR.save", []string{"1d20+5"}, []string{"str.save"}},
+		{"!roll +@dex 1d20", []string{"1d20+2"}, []string{"dex"}},
+		{"!roll 1d20+@dex for 3 rounds", []string{"1d20+2"}, []string{"dex"}},
+		{"<@1234> !roll 1d20+@dex", []string{"1d20+2"}, []string{"dex"}},
+	} {
+		reqs, used, err := resolveVariables(vars, e, tc.expr)
+		if err != nil {
+			t.Errorf("resolveVariables(%q) = %v", tc.expr, err)
+			continue
+		}
+		if got := fmtRequests(reqs); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("resolveVariables(%q) = %v, want %v", tc.expr, got, tc.want)
+		}
+		if !reflect.DeepEqual(used, tc.wantVars) {
+			t.Errorf("resolveVariables(%q) used %v, want %v", tc.expr, used, tc.wantVars)
+		}
+	}
+}
+
+func TestResolveVariablesErrors(t *testing.T) {
+	vars := fakeVariables{"dex": 2}
+	e := &baepi.Baevent{}
+	for _, tc := range []struct {
+		vr   VariableResolver
+		expr string
+		want string
+	}{
+		{nil, "1d20+@dex", "need characters"},
+		{vars, "1d20+@luck", "@luck"},
+		{vars, "1d20+@dex-1d4", "not take them away"},
+		{vars, "+@dex", "no dice"},
+		{vars, "1d20+@dex+99999", "can't add that much"},
+	} {
+		reqs, _, err := resolveVariables(tc.vr, e, tc.expr)
+		if err == nil {
+			// Troll messages are errors too, as far as rollers are concerned.
+			for _, r := range reqs {
+				if r.TrollMsg != "" {
+					err = fmt.Errorf("%s", r.TrollMsg)
+				}
+			}
+		}
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("resolveVariables(%q) = %v, want an error with %q", tc.expr, err, tc.want)
+		}
+	}
+}
+
+func TestHasVariables(t *testing.T) {
+	for expr, want := range map[string]bool{
+		"1d20+@dex":         true,
+		"1d20 - @str.save":  true,
+		"<@1234> 1d20":      false,
+		"<@!1234> 2d6+3":    false,
+		"1d20 +@dex # bob":  true,
+		"email me@host 1d4": false,
+	} {
+		if got := hasVariables(expr); got != want {
+			t.Errorf("hasVariables(%q) = %v, want %v", expr, got, want)
+		}
+	}
+}
+
+func TestRollKind(t *testing.T) {
+	for _, tc := range []struct {
+		msg  string
+		vars []string
+		want RollKind
+	}{
+		{"!roll d20+@dex", []string{"dex"}, CheckRoll},
+		{"!roll d20+@dex.save", []string{"dex.save"}, SaveRoll},
+		{"!roll d20+@str+@prof # Attack the orc", []string{"str", "prof"}, AttackRoll},
+		{"!roll d20+@con # save vs. poison", []string{"con"}, SaveRoll},
+		{"!roll d20+@wis.save # check", []string{"wis.save"}, CheckRoll},
+		{"!roll d20+@dex # attacker's lunch", []string{"dex"}, CheckRoll},
+	} {
+		if got := rollKind(tc.msg, tc.vars); got != tc.want {
+			t.Errorf("rollKind(%q, %q) = %v, want %v", tc.msg, tc.vars, got, tc.want)
+		}
+	}
+}
+
+// fakeEffects gives every roll of one kind the same effects.
+type fakeEffects struct {
+	fakeVariables
+	kind  RollKind
+	adv   Advantage
+	extra []*RollRequest
+	why   string
+}
+
+func (fe fakeEffects) RollEffects(e *baepi.Baevent, kind RollKind, vars []string) (Advantage, []*RollRequest, string) {
+	if kind != fe.kind {
+		return NoAdvantage, nil, ""
+	}
+	return fe.adv, fe.extra, fe.why
+}
+
+func TestApplyEffects(t *testing.T) {
+	vars := fakeVariables{"str": 3, "dex": 2}
+	blessed := fakeEffects{vars, AttackRoll, WithDisadvantage, []*RollRequest{{Multiplier: 1, Die: 4}}, "poisoned, blessed"}
+	for _, tc := range []struct {
+		desc    string
+		vr      VariableResolver
+		msg     string
+		wantAdv []Advantage
+		wantLen int
+		wantWhy string
+	}{
+		{"no effects", vars, "!roll d20+@str # attack", []Advantage{NoAdvantage}, 0, ""},
+		{"attack", blessed, "!roll d20+@str # attack", []Advantage{WithDisadvantage}, 1, "poisoned, blessed"},
+		{"not an attack", blessed, "!roll d20+@str", []Advantage{NoAdvantage}, 0, ""},
+		{"damage only", blessed, "!roll 2d6+@str # attack", []Advantage{NoAdvantage}, 0, ""},
+		{"first d20 only", blessed, "!roll 2d6+d20+@str+d20 # attack", []Advantage{NoAdvantage, WithDisadvantage, NoAdvantage}, 1, "poisoned, blessed"},
+	} {
+		e := &baepi.Baevent{Message: tc.msg}
+		reqs, used, err := resolveVariables(tc.vr, e, tc.msg)
+		if err != nil {
+			t.Fatalf("%s: resolveVariables() = %v", tc.desc, err)
+		}
+		extra, why := applyEffects(tc.vr, e, reqs, used)
+		var adv []Advantage
+		for _, r := range reqs {
+			adv = append(adv, r.Advantage)
+		}
+		if !reflect.DeepEqual(adv, tc.wantAdv) || len(extra) != tc.wantLen || why != tc.wantWhy {
+			t.Errorf("%s: got advantage %v, %d extra dice and %q, want %v, %d and %q",
+				tc.desc, adv, len(extra), why, tc.wantAdv, tc.wantLen, tc.wantWhy)
+		}
+	}
+}
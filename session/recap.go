@@ -0,0 +1,150 @@
+package session
+
+import (
+	"fmt"
+	"sort"
+
+	"dicebae/baepi"
+	"dicebae/roll"
+)
+
+// Recap summarizes the rolls made during a session.
+type Recap struct {
+	Players       []*PlayerStats `json:"players"`
+	HighestDamage *NotableRoll   `json:"highestDamage,omitempty"`
+}
+
+// PlayerStats tallies one player's rolls during a session. Only single d20
+// rolls count towards nat 20s, nat 1s and luck.
+type PlayerStats struct {
+	Username string `json:"username"`
+	Rolls    int    `json:"rolls"`
+	Nat20s   int    `json:"nat20s"`
+	Nat1s    int    `json:"nat1s"`
+	D20s     int    `json:"d20s"`
+	D20Total int    `json:"d20Total"`
+}
+
+// NotableRoll records a single roll worth bragging about.
+type NotableRoll struct {
+	Username   string `json:"username"`
+	Expression string `json:"expression"`
+	Total      int    `json:"total"`
+}
+
+// newRecap builds a recap from the roll history of a session.
+func newRecap(hist []*baepi.BaeHistoryEntry) *Recap {
+	rc := &Recap{}
+	byUser := make(map[string]*PlayerStats)
+	for _, bhe := range hist {
+		rr, ok := bhe.Response.HandlerMetadata.(roll.RollResponse)
+		if !ok || rr.TrollResponse != "" || bhe.RepliedTo == nil {
+			continue
+		}
+		ps := byUser[bhe.RepliedTo.ID]
+		if ps == nil {
+			ps = &PlayerStats{Username: bhe.RepliedTo.Username}
+			byUser[bhe.RepliedTo.ID] = ps
+			rc.Players = append(rc.Players, ps)
+		}
+		ps.Rolls++
+		hasD20 := false
+		for _, res := range rr.Results {
+			if res.Request.Die != 20 || len(res.BaseRolls) != 1 {
+				continue
+			}
+			hasD20 = true
+			ps.D20s++
+			ps.D20Total += res.BaseRolls[0]
+			switch res.BaseRolls[0] {
+			case 20:
+				ps.Nat20s++
+			case 1:
+				ps.Nat1s++
+			}
+		}
+		// Anything without a d20 in it is probably damage.
+		dmg := &rr
+		if rr.Damage != nil {
+			dmg = rr.Damage
+		} else if hasD20 {
+			continue
+		}
+		if rc.HighestDamage == nil || dmg.Total > rc.HighestDamage.Total {
+			rc.HighestDamage = &NotableRoll{
+				Username:   bhe.RepliedTo.Username,
+				Expression: expression(*dmg),
+				Total:      dmg.Total,
+			}
+		}
+	}
+	sort.Slice(rc.Players, func(i, j int) bool {
+		if rc.Players[i].Rolls != rc.Players[j].Rolls {
+			return rc.Players[i].Rolls > rc.Players[j].Rolls
+		}
+		return rc.Players[i].Username < rc.Players[j].Username
+	})
+	return rc
+}
+
+// Rolls returns the total number of rolls made during the session.
+func (rc *Recap) Rolls() int {
+	if rc == nil {
+		return 0
+	}
+	var n int
+	for _, ps := range rc.Players {
+		n += ps.Rolls
+	}
+	return n
+}
+
+// luckExtremes returns the players with the highest and lowest average d20,
+// or nils if nobody rolled a d20.
+func (rc *Recap) luckExtremes() (luckiest, unluckiest *PlayerStats) {
+	for _, ps := range rc.Players {
+		if ps.D20s == 0 {
+			continue
+		}
+		if luckiest == nil || ps.meanD20() > luckiest.meanD20() {
+			luckiest = ps
+		}
+		if unluckiest == nil || ps.meanD20() < unluckiest.meanD20() {
+			unluckiest = ps
+		}
+	}
+	return luckiest, unluckiest
+}
+
+func (ps *PlayerStats) meanD20() float64 {
+	return float64(ps.D20Total) / float64(ps.D20s)
+}
+
+func (rc *Recap) lines() []string {
+	var out []string
+	for _, ps := range rc.Players {
+		out = append(out, fmt.Sprintf("%s: %d rolls, %d nat 20s, %d nat 1s", ps.Username, ps.Rolls, ps.Nat20s, ps.Nat1s))
+	}
+	if hd := rc.HighestDamage; hd != nil {
+		out = append(out, fmt.Sprintf("Biggest hit: %s with **%d** (%s)", hd.Username, hd.Total, hd.Expression))
+	}
+	lucky, unlucky := rc.luckExtremes()
+	if lucky != nil && lucky != unlucky {
+		out = append(out,
+			fmt.Sprintf("Luckiest: %s (avg d20 %.1f)", lucky.Username, lucky.meanD20()),
+			fmt.Sprintf("Unluckiest: %s (avg d20 %.1f), my condolences", unlucky.Username, unlucky.meanD20()),
+		)
+	}
+	return out
+}
+
+func expression(rr roll.RollResponse) string {
+	var s string
+	for i, res := range rr.Results {
+		if i > 0 {
+			s += ", "
+		}
+		s += res.Request.String()
+	}
+	return s
+}
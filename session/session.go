@@ -0,0 +1,206 @@
+// Package session brackets the bae's history into game sessions and recaps
+// the rolls made during each one. Sessions are stored in the bae's history
+// like any other response, so they survive restarts along with it, but pinned,
+// so a long session's rolls can't push them out.
+package session
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"dicebae/baepi"
+	"dicebae/roll"
+)
+
+var (
+	maxListedSessions = 10
+	maxSessionRolls   = 1000
+)
+
+// SessionHandler implements the BaeSayHandler interface for starting, ending
+// and browsing game sessions.
+type SessionHandler struct {
+	hotword string
+}
+
+// Event is the HandlerMetadata of every session command that changes or
+// records a session.
+type Event struct {
+	Action string    `json:"action"` // "start" or "end".
+	Name   string    `json:"name"`
+	Start  time.Time `json:"start"`
+	End    time.Time `json:"end"`
+	Recap  *Recap    `json:"recap,omitempty"`
+}
+
+func init() {
+	baepi.RegisterMetadata("session.Event", &Event{})
+}
+
+func NewSessionHandler(hotword string) *SessionHandler {
+	return &SessionHandler{hotword: hotword}
+}
+
+func (sh *SessionHandler) ShouldSay(db baepi.DiceBae, e *baepi.Baevent) bool {
+	return strings.HasPrefix(e.Message, "!"+sh.hotword)
+}
+
+func (sh *SessionHandler) SayWithBae(db baepi.DiceBae, e *baepi.Baevent) (*baepi.Baesponse, error) {
+	args := strings.TrimSpace(strings.TrimPrefix(e.Message, "!"+sh.hotword))
+	cmd, rest := args, ""
+	if i := strings.IndexAny(args, " \t"); i >= 0 {
+		cmd, rest = args[:i], strings.TrimSpace(args[i:])
+	}
+	switch strings.ToLower(cmd) {
+	case "start":
+		return sh.start(db, e, strings.Trim(rest, `"'“”`))
+	case "end", "stop":
+		return sh.end(db, e)
+	case "list":
+		return sh.list(db, e)
+	case "show":
+		return sh.show(db, e, rest)
+	case "":
+		if cur := currentSession(db, e.ChannelID); cur != nil {
+			return say(fmt.Sprintf("**%s** has been going for %s.", cur.Name, fmtDuration(time.Since(cur.Start)))), nil
+		}
+		return say(fmt.Sprintf("No session running. Try !%s start \"Session Name\".", sh.hotword)), nil
+	default:
+		return say(fmt.Sprintf("I only know !%s start|end|list|show.", sh.hotword)), nil
+	}
+}
+
+func (sh *SessionHandler) start(db baepi.DiceBae, e *baepi.Baevent, name string) (*baepi.Baesponse, error) {
+	if cur := currentSession(db, e.ChannelID); cur != nil {
+		return say(fmt.Sprintf("**%s** is still going, !%s end it first.", cur.Name, sh.hotword)), nil
+	}
+	if name == "" {
+		name = fmt.Sprintf("Session %d", len(pastSessions(db, e.ChannelID, maxSessionRolls))+1)
+	}
+	ev := &Event{Action: "start", Name: name, Start: time.Now()}
+	return &baepi.Baesponse{
+		Message:         fmt.Sprintf("**%s** has begun. May your dice be kind.", name),
+		HandlerMetadata: ev,
+		// However many rolls the session sees, it has to be able to find its
+		// start to end.
+		Pinned: true,
+	}, nil
+}
+
+func (sh *SessionHandler) end(db baepi.DiceBae, e *baepi.Baevent) (*baepi.Baesponse, error) {
+	cur := currentSession(db, e.ChannelID)
+	if cur == nil {
+		return say("There's no session to end, you ass."), nil
+	}
+	ev := &Event{Action: "end", Name: cur.Name, Start: cur.Start, End: time.Now()}
+	hist := db.FetchHistory(&baepi.BaeHistoKey{
+		HandlerName: "roll",
+		ChannelID:   e.ChannelID,
+		Since:       ev.Start,
+		Until:       ev.End,
+		Filter:      roll.IsRoll,
+	}, maxSessionRolls)
+	ev.Recap = newRecap(hist)
+	return &baepi.Baesponse{
+		Message:         ev.String(),
+		HandlerMetadata: ev,
+		Pinned:          true,
+	}, nil
+}
+
+func (sh *SessionHandler) list(db baepi.DiceBae, e *baepi.Baevent) (*baepi.Baesponse, error) {
+	var out []string
+	if cur := currentSession(db, e.ChannelID); cur != nil {
+		out = append(out, fmt.Sprintf("Now: **%s**, started %s", cur.Name, cur.Start.Format("Jan 2 15:04")))
+	}
+	for i, ev := range pastSessions(db, e.ChannelID, maxListedSessions) {
+		out = append(out, fmt.Sprintf("%d. **%s**, %s for %s, %d rolls",
+			i+1, ev.Name, ev.Start.Format("Jan 2"), fmtDuration(ev.End.Sub(ev.Start)), ev.Recap.Rolls()))
+	}
+	if len(out) == 0 {
+		return say("No sessions yet."), nil
+	}
+	out = append(out, fmt.Sprintf("(!%s show N for a recap)", sh.hotword))
+	return say(strings.Join(out, "\n")), nil
+}
+
+func (sh *SessionHandler) show(db baepi.DiceBae, e *baepi.Baevent, which string) (*baepi.Baesponse, error) {
+	past := pastSessions(db, e.ChannelID, maxSessionRolls)
+	if len(past) == 0 {
+		return say("No sessions yet."), nil
+	}
+	if which == "" {
+		return say(past[0].String()), nil
+	}
+	if n, err := strconv.Atoi(which); err == nil {
+		if n < 1 || n > len(past) {
+			return say(fmt.Sprintf("I only remember %d sessions.", len(past))), nil
+		}
+		return say(past[n-1].String()), nil
+	}
+	for _, ev := range past {
+		if strings.EqualFold(ev.Name, strings.Trim(which, `"'“”`)) {
+			return say(ev.String()), nil
+		}
+	}
+	return say(fmt.Sprintf("I don't remember a session called %q.", which)), nil
+}
+
+// currentSession returns the start event of the session running in the
+// channel, if any.
+func currentSession(db baepi.DiceBae, channelID string) *Event {
+	hist := db.FetchHistory(sessionEvents(channelID, nil), 1)
+	if len(hist) == 0 {
+		return nil
+	}
+	if ev := hist[0].Response.HandlerMetadata.(*Event); ev.Action == "start" {
+		return ev
+	}
+	return nil
+}
+
+// pastSessions returns up to n finished sessions in the channel, newest first.
+func pastSessions(db baepi.DiceBae, channelID string, n int) []*Event {
+	var ret []*Event
+	ended := func(ev *Event) bool { return ev.Action == "end" }
+	for _, bhe := range db.FetchHistory(sessionEvents(channelID, ended), n) {
+		ret = append(ret, bhe.Response.HandlerMetadata.(*Event))
+	}
+	return ret
+}
+
+// sessionEvents returns a key for the session events in a channel, skipping
+// replies like !session list that don't start or end anything. If f is set,
+// it further filters the events.
+func sessionEvents(channelID string, f func(*Event) bool) *baepi.BaeHistoKey {
+	return &baepi.BaeHistoKey{
+		HandlerName: "session",
+		ChannelID:   channelID,
+		Filter: func(bhe *baepi.BaeHistoryEntry) bool {
+			ev, ok := bhe.Response.HandlerMetadata.(*Event)
+			return ok && (f == nil || f(ev))
+		},
+	}
+}
+
+func (ev *Event) String() string {
+	out := []string{fmt.Sprintf("**%s recap** (%s)", ev.Name, fmtDuration(ev.End.Sub(ev.Start)))}
+	if ev.Recap == nil || ev.Recap.Rolls() == 0 {
+		return out[0] + "\nNobody rolled anything. Was this a roleplay session?"
+	}
+	return strings.Join(append(out, ev.Recap.lines()...), "\n")
+}
+
+func fmtDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+	if d < time.Hour {
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	}
+	return fmt.Sprintf("%dh%02dm", int(d.Hours()), int(d.Minutes())%60)
+}
+
+func say(msg string) *baepi.Baesponse {
+	return &baepi.Baesponse{Message: msg, MentionUser: true}
+}